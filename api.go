@@ -0,0 +1,95 @@
+package formailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// env looks up a per email setting falling back on the default. ex: SENDGRID_CONTACT_API_KEY then SENDGRID_API_KEY.
+func (e *Email) env(service, key string) string {
+	prefix := fmt.Sprintf("%s_%s_", service, strings.ToUpper(e.ID))
+	return or(os.Getenv(prefix+key), os.Getenv(service+"_"+key))
+}
+
+// requireEnv is env returning an error like the SMTP settings when the setting is missing
+func (e *Email) requireEnv(name, service, key string) (string, error) {
+	v := e.env(service, key)
+	if len(v) < 1 {
+		prefix := fmt.Sprintf("%s_%s_", service, strings.ToUpper(e.ID))
+		return "", fmt.Errorf("incomplete %s configuration missing %s%s or %s_%s for %s", name, prefix, key, service, key, e.ID)
+	}
+	return v, nil
+}
+
+// APIError is returned by the HTTP API senders when the API responds with a non 2xx status.
+type APIError struct {
+	Host       string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s responded with %s: %s", e.Host, e.Status, e.Body)
+}
+
+// post sends an API request returning an error for any non 2xx response
+func post(client *http.Client, url, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	return do(client, req)
+}
+
+// apiClient gives up on an API that doesn't respond so the function isn't left hanging until the platform kills it
+var apiClient = &http.Client{Timeout: 30 * time.Second}
+
+func do(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = apiClient
+	}
+
+	var wrote atomic.Bool
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			wrote.Store(info.Err == nil)
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := client.Do(req)
+	if err != nil && wrote.Load() {
+		// The API may have accepted the email before the response was lost so trying again could send it twice
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return fmt.Errorf("%s timed out, the email may have been delivered: %v", req.URL.Host, err)
+		}
+		return err
+	}
+	if err != nil {
+		// The request was never sent so it's worth trying again
+		return Transient(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &APIError{Host: req.URL.Host, StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(b))}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package formailer
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAPIEmail generates an email with every field set
+func testAPIEmail(t *testing.T) (*Email, *Submission) {
+	t.Helper()
+	e := &Email{
+		ID:      "api",
+		To:      "to@example.com",
+		From:    `"Cömpany" <from@example.com>`,
+		Cc:      []string{"cc@example.com"},
+		Bcc:     []string{"bcc@example.com"},
+		ReplyTo: "reply@example.com",
+		Subject: "Hëllo",
+		Tags:    []string{"contact", "website"},
+	}
+	s := &Submission{
+		Form:        testForm,
+		Order:       []string{"message"},
+		Values:      map[string]interface{}{"message": "Hello, World!"},
+		Attachments: []Attachment{{Filename: "file.txt", MimeType: "text/plain", Data: []byte("file contents")}},
+	}
+	return e, s
+}
+
+// testAPIServer records the last request made to it
+func testAPIServer(t *testing.T, r **http.Request, body *[]byte) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		*r = req
+		*body, _ = io.ReadAll(req.Body)
+		w.Write([]byte("{}"))
+	}))
+}
+
+func TestParseMessage(t *testing.T) {
+	e, s := testAPIEmail(t)
+	email, err := e.Email(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := parseMessage(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.From.Name != "Cömpany" || m.From.Address != "from@example.com" || m.Subject != "Hëllo" {
+		t.Errorf("Unexpected from or subject: %v %s", m.From, m.Subject)
+	}
+	if len(m.To) != 1 || len(m.Cc) != 1 || len(m.Bcc) != 1 || len(m.ReplyTo) != 1 || m.Bcc[0].Address != "bcc@example.com" {
+		t.Errorf("Unexpected recipients: %v %v %v %v", m.To, m.Cc, m.Bcc, m.ReplyTo)
+	}
+	if !strings.Contains(m.Text, "Hello, World!") || !strings.Contains(m.HTML, "Hello, World!") {
+		t.Errorf("Unexpected body\n%s\n%s", m.Text, m.HTML)
+	}
+	if len(m.Attachments) != 1 || string(m.Attachments[0].Data) != "file contents" || m.Attachments[0].Filename != "file.txt" {
+		t.Errorf("Unexpected attachments: %v", m.Attachments)
+	}
+	if len(m.Headers["Message-Id"]) < 1 {
+		t.Errorf("Expected Message-Id to be passed through: %v", m.Headers)
+	}
+}
+
+func TestSendGridSender(t *testing.T) {
+	var r *http.Request
+	var body []byte
+	server := testAPIServer(t, &r, &body)
+	defer server.Close()
+
+	t.Setenv("SENDGRID_API_KEY", "default")
+	t.Setenv("SENDGRID_API_API_KEY", "override")
+
+	e, s := testAPIEmail(t)
+	e.Sender = SendGridSender{BaseURL: server.URL}
+	email, err := e.Email(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Send(email); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.URL.Path != "/v3/mail/send" || r.Header.Get("Authorization") != "Bearer override" {
+		t.Errorf("Unexpected request %s %v", r.URL, r.Header)
+	}
+
+	var m sendGridMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatal(err)
+	}
+	p := m.Personalizations[0]
+	if p.To[0].Email != "to@example.com" || p.Cc[0].Email != "cc@example.com" || p.Bcc[0].Email != "bcc@example.com" {
+		t.Errorf("Unexpected personalization: %+v", p)
+	}
+	if m.ReplyTo.Email != "reply@example.com" || m.From.Name != "Cömpany" || len(m.Content) != 2 || len(m.Attachments) != 1 || len(m.Categories) != 2 {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+}
+
+func TestPostmarkSender(t *testing.T) {
+	var r *http.Request
+	var body []byte
+	server := testAPIServer(t, &r, &body)
+	defer server.Close()
+
+	t.Setenv("POSTMARK_SERVER_TOKEN", "token")
+
+	e, s := testAPIEmail(t)
+	e.Sender = PostmarkSender{BaseURL: server.URL}
+	email, err := e.Email(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Send(email); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.URL.Path != "/email" || r.Header.Get("X-Postmark-Server-Token") != "token" {
+		t.Errorf("Unexpected request %s %v", r.URL, r.Header)
+	}
+
+	var m postmarkMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.To != "<to@example.com>" || m.Bcc != "<bcc@example.com>" || len(m.HtmlBody) < 1 || len(m.TextBody) < 1 || len(m.Attachments) != 1 || m.Tag != "contact" {
+		t.Errorf("Unexpected message: %+v", m)
+	}
+}
+
+func TestMailgunSender(t *testing.T) {
+	var r *http.Request
+	var body []byte
+	server := testAPIServer(t, &r, &body)
+	defer server.Close()
+
+	t.Setenv("MAILGUN_API_KEY", "key")
+	t.Setenv("MAILGUN_DOMAIN", "mg.example.com")
+
+	e, s := testAPIEmail(t)
+	e.Sender = MailgunSender{BaseURL: server.URL}
+	email, err := e.Email(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Send(email); err != nil {
+		t.Fatal(err)
+	}
+
+	user, pass, _ := r.BasicAuth()
+	if r.URL.Path != "/v3/mg.example.com/messages.mime" || user != "api" || pass != "key" {
+		t.Errorf("Unexpected request %s %s:%s", r.URL, user, pass)
+	}
+	if !strings.Contains(string(body), "bcc@example.com") || !strings.Contains(string(body), "multipart/alternative") {
+		t.Errorf("Expected recipients and raw message in body\n%s", body)
+	}
+	if strings.Count(string(body), `name="o:tag"`) != 2 {
+		t.Errorf("Expected every tag to be sent\n%s", body)
+	}
+}
+
+func TestSESSender(t *testing.T) {
+	var r *http.Request
+	var body []byte
+	server := testAPIServer(t, &r, &body)
+	defer server.Close()
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("SES_SECRET_ACCESS_KEY", "secret")
+
+	e, s := testAPIEmail(t)
+	e.Sender = SESSender{BaseURL: server.URL}
+	email, err := e.Email(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Send(email); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.URL.Path != "/v2/email/outbound-emails" || !strings.Contains(r.Header.Get("Authorization"), "Credential=AKIDEXAMPLE/") {
+		t.Errorf("Unexpected request %s %v", r.URL, r.Header)
+	}
+
+	var m sesMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Destination.ToAddresses) != 3 || !strings.Contains(string(m.Content.Raw.Data), "Subject:") {
+		t.Errorf("Unexpected message: %v\n%s", m.Destination, m.Content.Raw.Data)
+	}
+}
+
+// TestSignV4 uses the example from the AWS Signature Version 4 documentation
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	now, _ := time.Parse("20060102T150405Z", "20150830T123600Z")
+	signV4(req, nil, now, "us-east-1", "iam", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if auth := req.Header.Get("Authorization"); auth != expected {
+		t.Errorf("Unexpected signature\nExpected: %s\nGot: %s", expected, auth)
+	}
+}
+
+func TestAPIMissingCredentials(t *testing.T) {
+	t.Setenv("POSTMARK_SERVER_TOKEN", "")
+	e := &Email{ID: "missing"}
+	err := PostmarkSender{}.Send(e, nil)
+	if err == nil || !strings.Contains(err.Error(), "POSTMARK_MISSING_SERVER_TOKEN or POSTMARK_SERVER_TOKEN") {
+		t.Errorf("Expected missing configuration error; Got: %v", err)
+	}
+}
+
+func TestAPITimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	err := post(client, server.URL, "application/json", []byte("{}"), nil)
+	if err == nil || IsTransient(err) {
+		t.Errorf("Expected a permanent error once the request was sent; Got: %v", err)
+	}
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	err = post(client, unreachable.URL, "application/json", []byte("{}"), nil)
+	if err == nil || !IsTransient(err) {
+		t.Errorf("Expected a transient error when the request wasn't sent; Got: %v", err)
+	}
+}
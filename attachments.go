@@ -0,0 +1,257 @@
+package formailer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AttachmentLimits restricts the files that can be uploaded with a submission. Zero values aren't limited.
+// Files that break a limit are dropped and reported by Submission.Validate as errors for the field they were uploaded in.
+type AttachmentLimits struct {
+	// MaxFileSize is the largest a single file can be in bytes.
+	MaxFileSize int64 `yaml:"max_file_size"`
+
+	// MaxTotalSize is the largest all the files together can be in bytes.
+	MaxTotalSize int64 `yaml:"max_total_size"`
+
+	// MaxCount is how many files can be uploaded.
+	MaxCount int `yaml:"max_count"`
+
+	// Extensions lists the allowed file name extensions, like .pdf or png. Case is ignored.
+	Extensions []string `yaml:"extensions"`
+
+	// MimeTypes lists the allowed types, like application/pdf or image/*.
+	// The type is detected from the file's content with http.DetectContentType, the Content-Type sent by the browser is ignored.
+	MimeTypes []string `yaml:"mime_types"`
+}
+
+// DetectMimeType returns the media type of data detected from its content, without parameters.
+func DetectMimeType(data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// validate returns an error for negative limits or malformed MIME types
+func (l AttachmentLimits) validate() error {
+	if l.MaxFileSize < 0 || l.MaxTotalSize < 0 || l.MaxCount < 0 {
+		return errors.New("attachment limits can't be negative")
+	}
+	for _, t := range l.MimeTypes {
+		if _, _, err := mime.ParseMediaType(t); err != nil || !strings.Contains(t, "/") {
+			return fmt.Errorf("invalid attachment mime type %q", t)
+		}
+	}
+	return nil
+}
+
+// remaining returns how many bytes the next file can be given the files uploaded before it, or -1 when it isn't limited.
+// message describes the limit a larger file breaks.
+func (l AttachmentLimits) remaining(filename string, uploaded []Attachment) (limit int64, message string) {
+	_, total := l.filter(uploaded, nil)
+	limit = -1
+	if l.MaxFileSize > 0 {
+		limit, message = l.MaxFileSize, l.fileSizeMessage(filename)
+	}
+	if left := l.MaxTotalSize - total; l.MaxTotalSize > 0 && (limit < 0 || left < limit) {
+		limit, message = max(left, 0), l.totalSizeMessage()
+	}
+	return limit, message
+}
+
+func (l AttachmentLimits) fileSizeMessage(filename string) string {
+	return fmt.Sprintf("%s must be at most %s", filename, formatSize(l.MaxFileSize))
+}
+
+func (l AttachmentLimits) totalSizeMessage() string {
+	return fmt.Sprintf("files must be at most %s in total", formatSize(l.MaxTotalSize))
+}
+
+// looser combines the limits of two forms keeping the larger of each size limit, zero being the largest
+func (l AttachmentLimits) looser(other AttachmentLimits) AttachmentLimits {
+	larger := func(a, b int64) int64 {
+		if a == 0 || b == 0 {
+			return 0
+		}
+		return max(a, b)
+	}
+	return AttachmentLimits{
+		MaxFileSize:  larger(l.MaxFileSize, other.MaxFileSize),
+		MaxTotalSize: larger(l.MaxTotalSize, other.MaxTotalSize),
+	}
+}
+
+// check returns a message describing why the file isn't allowed, or an empty string when it is
+func (l AttachmentLimits) check(a Attachment) string {
+	if l.MaxFileSize > 0 && a.size() > l.MaxFileSize {
+		return l.fileSizeMessage(a.Filename)
+	}
+
+	if len(l.Extensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(a.Filename))
+		allowed := false
+		for _, e := range l.Extensions {
+			allowed = allowed || (len(ext) > 0 && strings.TrimPrefix(strings.ToLower(e), ".") == ext[1:])
+		}
+		if !allowed {
+			return fmt.Sprintf("%s must be one of %s", a.Filename, strings.Join(l.Extensions, ", "))
+		}
+	}
+
+	if len(l.MimeTypes) > 0 {
+		detected := a.mimeType()
+		allowed := false
+		for _, t := range l.MimeTypes {
+			t = strings.ToLower(t)
+			allowed = allowed || t == detected || (strings.HasSuffix(t, "/*") && strings.HasPrefix(detected, t[:len(t)-1]))
+		}
+		if !allowed {
+			return fmt.Sprintf("%s is a %s file which isn't allowed", a.Filename, detected)
+		}
+	}
+
+	return ""
+}
+
+// formatSize writes bytes in the largest whole unit
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// checkAttachments drops attachments breaking the form's limits and keeps an error for each field so Validate can report them.
+// Files skipped for their size while parsing already have an error.
+func (s *Submission) checkAttachments() {
+	kept, _ := s.Form.AttachmentLimits.filter(s.Attachments, func(field, message string) {
+		if !s.attachmentErrors.has(field) {
+			s.attachmentErrors = append(s.attachmentErrors, FieldError{Field: field, Message: message})
+		}
+	})
+	s.removeAttachments(kept)
+
+	sort.Slice(s.attachmentErrors, func(i, j int) bool {
+		return s.attachmentErrors[i].Field < s.attachmentErrors[j].Field
+	})
+}
+
+// filter returns the attachments within the limits in order and their total size, fail is called for every attachment left out
+func (l AttachmentLimits) filter(attachments []Attachment, fail func(field, message string)) ([]Attachment, int64) {
+	if fail == nil {
+		fail = func(string, string) {}
+	}
+
+	var kept []Attachment
+	var total int64
+	for _, a := range attachments {
+		if message := l.check(a); len(message) > 0 {
+			fail(a.Field, message)
+			continue
+		}
+		if l.MaxCount > 0 && len(kept) >= l.MaxCount {
+			fail(a.Field, fmt.Sprintf("must have at most %d files", l.MaxCount))
+			continue
+		}
+		if l.MaxTotalSize > 0 && total+a.size() > l.MaxTotalSize {
+			fail(a.Field, l.totalSizeMessage())
+			continue
+		}
+
+		total += a.size()
+		kept = append(kept, a)
+	}
+	return kept, total
+}
+
+// Bytes returns the content of the attachment reading it from Path when it isn't in memory.
+func (a Attachment) Bytes() ([]byte, error) {
+	if len(a.Path) < 1 {
+		return a.Data, nil
+	}
+	return os.ReadFile(a.Path)
+}
+
+// size returns the length of the content
+func (a Attachment) size() int64 {
+	if len(a.Path) < 1 {
+		return int64(len(a.Data))
+	}
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// mimeType detects the type from the start of the content
+func (a Attachment) mimeType() string {
+	if len(a.Path) < 1 {
+		return DetectMimeType(a.Data)
+	}
+
+	file, err := os.Open(a.Path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer file.Close()
+
+	// DetectContentType only looks at the first 512 bytes
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	return DetectMimeType(head[:n])
+}
+
+// contentType is the detected type of the content, falling back on the type of the file name's extension when the content isn't recognized
+func (a Attachment) contentType() string {
+	detected := a.mimeType()
+	if detected == "application/octet-stream" {
+		if t := mime.TypeByExtension(filepath.Ext(a.Filename)); len(t) > 0 {
+			return t
+		}
+	}
+	return detected
+}
+
+// Cleanup removes the temporary files of attachments too large to keep in memory.
+// The built-in handlers call it once a submission has been handled, call it yourself when using Parse or ParseReader directly.
+func (s *Submission) Cleanup() error {
+	var errs []error
+	for i, a := range s.Attachments {
+		if len(a.Path) < 1 {
+			continue
+		}
+		if err := os.Remove(a.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+		s.Attachments[i].Path = ""
+	}
+	return errors.Join(errs...)
+}
+
+// removeAttachments replaces the attachments with kept removing the temporary files of any that were dropped
+func (s *Submission) removeAttachments(kept []Attachment) {
+	paths := make(map[string]bool)
+	for _, a := range kept {
+		paths[a.Path] = true
+	}
+	for _, a := range s.Attachments {
+		if len(a.Path) > 0 && !paths[a.Path] {
+			os.Remove(a.Path)
+		}
+	}
+	s.Attachments = kept
+}
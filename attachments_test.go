@@ -0,0 +1,226 @@
+package formailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	testPDF = []byte("%PDF-1.4\n%âãÏÓ\n")
+)
+
+// multipartBody writes fields and files as multipart/form-data returning the content type and body
+func multipartBody(fields map[string]string, files ...Attachment) (string, string) {
+	b := new(bytes.Buffer)
+	w := multipart.NewWriter(b)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	for _, f := range files {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", `form-data; name="`+f.Field+`"; filename="`+f.Filename+`"`)
+		header.Set("Content-Type", f.MimeType)
+		part, _ := w.CreatePart(header)
+		part.Write(f.Data)
+	}
+	w.Close()
+	return w.FormDataContentType(), b.String()
+}
+
+func TestDetectMimeType(t *testing.T) {
+	tests := map[string][]byte{
+		"image/png":                testPNG,
+		"application/pdf":          testPDF,
+		"text/plain":               []byte("hello"),
+		"text/html":                []byte("<html><body>hi</body></html>"),
+		"application/octet-stream": {0x00, 0x01, 0x02},
+	}
+	for expected, data := range tests {
+		if detected := DetectMimeType(data); detected != expected {
+			t.Errorf("Unexpected mime type \nExpected: %s; Got: %s", expected, detected)
+		}
+	}
+}
+
+func TestAttachmentLimits(t *testing.T) {
+	tests := []struct {
+		limits   AttachmentLimits
+		files    []Attachment
+		kept     []string
+		expected ValidationError
+	}{
+		{
+			AttachmentLimits{},
+			[]Attachment{{Field: "cv", Filename: "cv.pdf", Data: testPDF}},
+			[]string{"cv.pdf"},
+			nil,
+		},
+		{
+			AttachmentLimits{MaxFileSize: 8},
+			[]Attachment{{Field: "cv", Filename: "cv.pdf", Data: testPDF}, {Field: "photo", Filename: "a.png", Data: testPNG[:8]}},
+			[]string{"a.png"},
+			ValidationError{{"cv", "cv.pdf must be at most 8 bytes"}},
+		},
+		{
+			AttachmentLimits{MaxCount: 1, MaxTotalSize: 1 << 10},
+			[]Attachment{{Field: "photos", Filename: "a.png", Data: testPNG}, {Field: "photos", Filename: "b.png", Data: testPNG}},
+			[]string{"a.png"},
+			ValidationError{{"photos", "must have at most 1 files"}},
+		},
+		{
+			AttachmentLimits{MaxTotalSize: 20},
+			[]Attachment{{Field: "photos", Filename: "a.png", Data: testPNG}, {Field: "photos", Filename: "b.png", Data: testPNG}},
+			[]string{"a.png"},
+			ValidationError{{"photos", "files must be at most 20 bytes in total"}},
+		},
+		{
+			AttachmentLimits{Extensions: []string{".PDF", "png"}},
+			[]Attachment{{Field: "cv", Filename: "CV.pdf", Data: testPDF}, {Field: "photo", Filename: "me.PNG", Data: testPNG}, {Field: "other", Filename: "run.exe", Data: testPDF}},
+			[]string{"CV.pdf", "me.PNG"},
+			ValidationError{{"other", "run.exe must be one of .PDF, png"}},
+		},
+		{
+			// The browser's Content-Type is ignored so renaming a file doesn't get it through
+			AttachmentLimits{MimeTypes: []string{"image/*", "application/pdf"}},
+			[]Attachment{{Field: "cv", Filename: "cv.pdf", MimeType: "application/pdf", Data: []byte("<html><script>alert(1)</script>")}, {Field: "photo", Filename: "me.png", MimeType: "text/plain", Data: testPNG}},
+			[]string{"me.png"},
+			ValidationError{{"cv", "cv.pdf is a text/html file which isn't allowed"}},
+		},
+	}
+
+	for i, test := range tests {
+		c := make(Config)
+		c.Add(&Form{ID: "upload", AttachmentLimits: test.limits})
+
+		contentType, body := multipartBody(map[string]string{"_form_name": "upload"}, test.files...)
+		s, err := c.Parse(contentType, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var kept []string
+		for _, a := range s.Attachments {
+			kept = append(kept, a.Filename)
+		}
+		if !cmp.Equal(kept, test.kept) {
+			t.Errorf("%d: unexpected attachments kept \nExpected: %v; Got: %v", i, test.kept, kept)
+		}
+
+		err = s.Validate()
+		var invalid ValidationError
+		errors.As(err, &invalid)
+		if !cmp.Equal(invalid, test.expected) {
+			t.Errorf("%d: unexpected validation error \nExpected: %v; Got: %v", i, test.expected, err)
+		}
+	}
+}
+
+func TestAttachmentMimeType(t *testing.T) {
+	c := make(Config)
+	c.Add(&Form{ID: "upload"})
+
+	contentType, body := multipartBody(map[string]string{"_form_name": "upload"},
+		Attachment{Field: "photo", Filename: "me.png", MimeType: "text/html", Data: testPNG},
+		Attachment{Field: "data", Filename: "data.json", MimeType: "text/html", Data: []byte{0x00, 0x01, 0x02}},
+		Attachment{Field: "blob", Filename: "blob", MimeType: "text/html", Data: []byte{0x00, 0x01, 0x02}},
+	)
+	s, err := c.Parse(contentType, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for _, a := range s.Attachments {
+		types = append(types, a.MimeType)
+	}
+	expected := []string{"image/png", "application/json", "application/octet-stream"}
+	if !cmp.Equal(types, expected) {
+		t.Errorf("Expected the client's Content-Type to be ignored \nExpected: %v; Got: %v", expected, types)
+	}
+}
+
+func TestAttachmentLimitsWithRules(t *testing.T) {
+	c := make(Config)
+	form := &Form{ID: "upload", AttachmentLimits: AttachmentLimits{MaxFileSize: 4}}
+	form.AddRule("name", Rule{Required: true})
+	form.AddRule("cv", Rule{Required: true})
+	c.Add(form)
+
+	contentType, body := multipartBody(map[string]string{"_form_name": "upload"}, Attachment{Field: "cv", Filename: "cv.pdf", Data: testPDF})
+	s, err := c.Parse(contentType, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ValidationError{{"cv", "cv.pdf must be at most 4 bytes"}, {"name", "is required"}}
+	if err := s.Validate(); !cmp.Equal(err, error(expected)) {
+		t.Errorf("Unexpected validation error \nExpected: %v; Got: %v", expected, err)
+	}
+}
+
+func TestAttachmentLimitsStreaming(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), 1<<20)
+	r := bytes.NewReader(large)
+	budget := int64(16)
+	data, path, ok, err := readFile(r, &budget, 1<<10)
+	if err != nil || ok || data != nil || len(path) > 0 {
+		t.Errorf("Expected a file over the limit not to be kept; Got: %d bytes %q %t %v", len(data), path, ok, err)
+	}
+	if r.Len() > 0 || budget != 16 {
+		t.Errorf("Expected the file to be drained without using the budget; Got: %d bytes left, budget %d", r.Len(), budget)
+	}
+
+	c := make(Config)
+	c.Add(&Form{ID: "upload", AttachmentLimits: AttachmentLimits{MaxFileSize: 1 << 10, MaxTotalSize: 3 << 10}})
+	c.Add(&Form{ID: "other", AttachmentLimits: AttachmentLimits{MaxFileSize: 2 << 10}})
+
+	// The form isn't known until _form_name is read so the first file is only held to the loosest limits while streaming
+	b := new(bytes.Buffer)
+	w := multipart.NewWriter(b)
+	for _, f := range []Attachment{{Field: "early", Filename: "early.txt", Data: large[:1500]}} {
+		part, _ := w.CreateFormFile(f.Field, f.Filename)
+		part.Write(f.Data)
+	}
+	w.WriteField("_form_name", "upload")
+	for _, f := range []Attachment{
+		{Field: "a", Filename: "a.txt", Data: large[:1<<10]},
+		{Field: "b", Filename: "b.txt", Data: large},
+		{Field: "c", Filename: "c.txt", Data: large[:1<<10]},
+		{Field: "d", Filename: "d.txt", Data: large[:1<<10]},
+		{Field: "e", Filename: "e.txt", Data: large[:1<<10]},
+	} {
+		part, _ := w.CreateFormFile(f.Field, f.Filename)
+		part.Write(f.Data)
+	}
+	w.Close()
+
+	s, err := c.ParseReader(context.Background(), w.FormDataContentType(), b, WithMaxMemory(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Cleanup()
+
+	var kept []string
+	for _, a := range s.Attachments {
+		kept = append(kept, a.Filename)
+	}
+	if expected := []string{"a.txt", "c.txt", "d.txt"}; !cmp.Equal(kept, expected) {
+		t.Errorf("Unexpected attachments kept \nExpected: %v; Got: %v", expected, kept)
+	}
+
+	expected := ValidationError{
+		{"b", "b.txt must be at most 1KB"},
+		{"e", "files must be at most 3KB in total"},
+		{"early", "early.txt must be at most 1KB"},
+	}
+	if err := s.Validate(); !cmp.Equal(err, error(expected)) {
+		t.Errorf("Unexpected validation error \nExpected: %v; Got: %v", expected, err)
+	}
+}
@@ -0,0 +1,49 @@
+package formailer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AutoReply is a confirmation email sent to the person who submitted the form.
+// It is skipped when the address is missing or invalid, or the submission is suspected spam.
+type AutoReply struct {
+	// Email holds the template, subject, From address and SMTP settings of the reply. Its To field is replaced with the submitter's address.
+	Email
+
+	// Field is the submitted field containing the submitter's email address.
+	Field string
+
+	// Allow is called before sending and can be used to rate limit replies so the form can't be used as a spam relay.
+	// When it returns false the reply is skipped.
+	Allow func(address string, s *Submission) bool
+}
+
+// address returns the submitter's address or an empty string if it's missing or invalid
+func (a *AutoReply) address(s *Submission) string {
+	address := strings.TrimSpace(fmt.Sprint(first(s.Values[a.Field])))
+	if !isEmail(address) {
+		return ""
+	}
+	return address
+}
+
+// email returns the email to send to the submitter, or nil when the reply should be skipped
+func (a *AutoReply) email(s *Submission) *Email {
+	if s.Spam || len(a.Field) < 1 {
+		return nil
+	}
+
+	address := a.address(s)
+	if len(address) < 1 {
+		return nil
+	}
+	if a.Allow != nil && !a.Allow(address, s) {
+		return nil
+	}
+
+	// Reference the field in the template instead of using the address directly so user input is never parsed as a template
+	e := a.Email
+	e.To = fmt.Sprintf("{{first (index .Values %q)}}", a.Field)
+	return &e
+}
@@ -0,0 +1,63 @@
+package formailer
+
+import (
+	"testing"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+func TestAutoReply(t *testing.T) {
+	var recipients []string
+	form := &Form{
+		ID: "autoreply",
+		Sender: SenderFunc(func(e *Email, email *mail.Email) error {
+			recipients = append(recipients, email.GetRecipients()...)
+			return nil
+		}),
+	}
+	form.AddEmail(Email{To: "info@example.com", From: "noreply@example.com"})
+
+	allowed := true
+	form.AutoReply = &AutoReply{
+		Email: Email{From: "noreply@example.com", Subject: "Thanks {{first .Values.name}}"},
+		Field: "email",
+		Allow: func(string, *Submission) bool { return allowed },
+	}
+
+	tests := []struct {
+		email    interface{}
+		spam     bool
+		allow    bool
+		expected []string
+	}{
+		{[]string{"rayne@example.com"}, false, true, []string{"info@example.com", "rayne@example.com"}},
+		{"{{.Form}}@example.com", false, true, []string{"info@example.com", "{{.Form}}@example.com"}},
+		{[]string{"a@example.com, b@example.com"}, false, true, []string{"info@example.com"}},
+		{[]string{"rayne@example.com"}, true, true, []string{"info@example.com"}},
+		{[]string{"rayne@example.com"}, false, false, []string{"info@example.com"}},
+		{nil, false, true, []string{"info@example.com"}},
+	}
+
+	for _, test := range tests {
+		recipients = nil
+		allowed = test.allow
+		submission := &Submission{
+			Form:   form,
+			Spam:   test.spam,
+			Values: map[string]interface{}{"name": []string{"Rayne"}, "email": test.email},
+		}
+
+		if err := submission.Send(); err != nil {
+			t.Fatal(err)
+		}
+		if len(recipients) != len(test.expected) {
+			t.Errorf("Unexpected recipients for %v\nExpected: %v; Got: %v", test.email, test.expected, recipients)
+			continue
+		}
+		for i := range recipients {
+			if recipients[i] != test.expected[i] {
+				t.Errorf("Unexpected recipient\nExpected: %s; Got: %s", test.expected[i], recipients[i])
+			}
+		}
+	}
+}
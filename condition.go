@@ -0,0 +1,211 @@
+package formailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Condition decides whether an email is sent for a submission.
+// Use either Template or Field with Op and Value. When both are set both must pass.
+type Condition struct {
+	// Template is a go text template rendered against the Submission that must output true or false.
+	// ex: `{{eq (first .Values.department) "sales"}}`
+	Template string `yaml:"template"`
+
+	// Field is the submitted field Op compares against Value, or Values for the in and not_in operators.
+	// Fields with several values, like checkboxes, pass when any value passes. ne and not_in pass when no value matches.
+	Field  string   `yaml:"field"`
+	Op     string   `yaml:"op"`
+	Value  string   `yaml:"value"`
+	Values []string `yaml:"values"`
+}
+
+// Operators for Condition.Op. An empty Op is the same as OpEq.
+const (
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpContains = "contains"
+	OpIn       = "in"
+	OpNotIn    = "not_in"
+	OpMatches  = "matches"
+	OpEmpty    = "empty"
+	OpNotEmpty = "not_empty"
+	OpGt       = "gt"
+	OpGte      = "gte"
+	OpLt       = "lt"
+	OpLte      = "lte"
+)
+
+// validate returns an error if the condition can never be evaluated
+func (c *Condition) validate() error {
+	if len(c.Template) > 0 {
+		if _, err := c.template(); err != nil {
+			return fmt.Errorf("invalid condition template: %w", err)
+		}
+	}
+
+	if len(c.Field) < 1 {
+		if len(c.Template) < 1 {
+			return errors.New("condition is missing template or field")
+		}
+		if len(c.Op) > 0 {
+			return fmt.Errorf("condition op %s is missing field", c.Op)
+		}
+		return nil
+	}
+
+	switch strings.ToLower(c.Op) {
+	case "", OpEq, OpNe, OpContains, OpIn, OpNotIn, OpEmpty, OpNotEmpty:
+	case OpMatches:
+		if _, err := c.pattern(); err != nil {
+			return fmt.Errorf("invalid condition pattern: %w", err)
+		}
+	case OpGt, OpGte, OpLt, OpLte:
+		if _, err := strconv.ParseFloat(c.Value, 64); err != nil {
+			return fmt.Errorf("condition op %s requires a number value", c.Op)
+		}
+	default:
+		return fmt.Errorf("invalid condition op %q must be one of eq, ne, contains, in, not_in, matches, empty, not_empty, gt, gte, lt or lte", c.Op)
+	}
+	return nil
+}
+
+// pattern compiles Value as a regular expression the first time it is used
+func (c *Condition) pattern() (*regexp.Regexp, error) {
+	return compilePattern(c.Value)
+}
+
+// conditionTemplates caches parsed condition templates so they aren't parsed again for every submission
+var conditionTemplates sync.Map
+
+// template parses Template the first time it is used
+func (c *Condition) template() (*texttemplate.Template, error) {
+	if t, ok := conditionTemplates.Load(c.Template); ok {
+		return t.(*texttemplate.Template), nil
+	}
+
+	t, err := texttemplate.New("condition").Funcs(templateFuncMap).Parse(c.Template)
+	if err != nil {
+		return nil, err
+	}
+	conditionTemplates.Store(c.Template, t)
+	return t, nil
+}
+
+// Match reports whether the submission passes the condition. A nil condition always passes.
+func (c *Condition) Match(s *Submission) (bool, error) {
+	if c == nil {
+		return true, nil
+	}
+	if err := c.validate(); err != nil {
+		return false, err
+	}
+
+	if len(c.Template) > 0 {
+		ok, err := c.matchTemplate(s)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if len(c.Field) > 0 {
+		return c.matchField(s), nil
+	}
+	return true, nil
+}
+
+func (c *Condition) matchTemplate(s *Submission) (bool, error) {
+	t, err := c.template()
+	if err != nil {
+		return false, err
+	}
+
+	var out bytes.Buffer
+	if err := t.Execute(&out, s); err != nil {
+		return false, err
+	}
+
+	ok, err := strconv.ParseBool(strings.TrimSpace(out.String()))
+	if err != nil {
+		return false, fmt.Errorf("condition rendered %q expected true or false", strings.TrimSpace(out.String()))
+	}
+	return ok, nil
+}
+
+func (c *Condition) matchField(s *Submission) bool {
+	var vals []string
+	for _, v := range values(s.Values[c.Field]) {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			vals = append(vals, v)
+		}
+	}
+
+	op := strings.ToLower(c.Op)
+	switch op {
+	case OpEmpty:
+		return len(vals) < 1
+	case OpNotEmpty:
+		return len(vals) > 0
+	case OpNe:
+		return !anyValue(vals, func(v string) bool { return v == c.Value })
+	case OpNotIn:
+		return !anyValue(vals, func(v string) bool { return contains(c.Values, v) })
+	}
+
+	return anyValue(vals, func(v string) bool {
+		switch op {
+		case OpContains:
+			return strings.Contains(v, c.Value)
+		case OpIn:
+			return contains(c.Values, v)
+		case OpMatches:
+			re, _ := c.pattern()
+			return re.MatchString(v)
+		case OpGt, OpGte, OpLt, OpLte:
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return false
+			}
+			want, _ := strconv.ParseFloat(c.Value, 64)
+			switch op {
+			case OpGt:
+				return n > want
+			case OpGte:
+				return n >= want
+			case OpLt:
+				return n < want
+			}
+			return n <= want
+		}
+		return v == c.Value
+	})
+}
+
+func anyValue(vals []string, f func(string) bool) bool {
+	for _, v := range vals {
+		if f(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Selected returns the form's emails whose conditions pass for this submission, in order.
+func (s *Submission) Selected() ([]Email, error) {
+	var emails []Email
+	for _, e := range s.Form.Emails {
+		ok, err := e.Condition.Match(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check condition for %s: %w", or(e.ID, e.To), err)
+		}
+		if ok {
+			emails = append(emails, e)
+		}
+	}
+	return emails, nil
+}
@@ -0,0 +1,113 @@
+package formailer
+
+import (
+	"strings"
+	"testing"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+func TestConditionMatch(t *testing.T) {
+	s := &Submission{Values: map[string]interface{}{
+		"department": []string{"sales"},
+		"topics":     []string{"billing", "api"},
+		"budget":     "5000",
+		"blank":      " ",
+	}}
+
+	tests := []struct {
+		condition *Condition
+		expected  bool
+	}{
+		{nil, true},
+		{&Condition{Field: "department", Value: "sales"}, true},
+		{&Condition{Field: "department", Op: OpEq, Value: "support"}, false},
+		{&Condition{Field: "department", Op: OpNe, Value: "sales"}, false},
+		{&Condition{Field: "missing", Op: OpNe, Value: "sales"}, true},
+		{&Condition{Field: "topics", Value: "api"}, true},
+		{&Condition{Field: "topics", Op: OpContains, Value: "bill"}, true},
+		{&Condition{Field: "topics", Op: OpIn, Values: []string{"api", "sdk"}}, true},
+		{&Condition{Field: "topics", Op: OpNotIn, Values: []string{"api"}}, false},
+		{&Condition{Field: "department", Op: OpMatches, Value: "^sa"}, true},
+		{&Condition{Field: "blank", Op: OpEmpty}, true},
+		{&Condition{Field: "budget", Op: OpNotEmpty}, true},
+		{&Condition{Field: "budget", Op: OpGte, Value: "5000"}, true},
+		{&Condition{Field: "budget", Op: OpLt, Value: "1000"}, false},
+		{&Condition{Template: `{{eq (first .Values.department) "sales"}}`}, true},
+		{&Condition{Template: `{{eq (first .Values.department) "sales"}}`, Field: "budget", Op: OpGt, Value: "10000"}, false},
+	}
+
+	for _, test := range tests {
+		ok, err := test.condition.Match(s)
+		if err != nil {
+			t.Errorf("Unexpected error for %+v: %v", test.condition, err)
+			continue
+		}
+		if ok != test.expected {
+			t.Errorf("Unexpected match for %+v \nExpected: %v; Got: %v", test.condition, test.expected, ok)
+		}
+	}
+
+	for _, c := range []*Condition{
+		{},
+		{Field: "budget", Op: "between"},
+		{Field: "budget", Op: OpGt, Value: "lots"},
+		{Field: "department", Op: OpMatches, Value: "("},
+		{Template: `{{first .Values.department}}`},
+	} {
+		if _, err := c.Match(s); err == nil {
+			t.Errorf("Expected error for %+v", c)
+		}
+	}
+}
+
+func TestConditionalSend(t *testing.T) {
+	var sent []string
+	form := &Form{ID: "routing", Sender: SenderFunc(func(e *Email, email *mail.Email) error {
+		sent = append(sent, e.ID)
+		return nil
+	})}
+	form.AddEmail(
+		Email{ID: "sales", To: "sales@example.com", From: "b@example.com", Condition: &Condition{Field: "department", Value: "sales"}},
+		Email{ID: "support", To: "support@example.com", From: "b@example.com", Condition: &Condition{Field: "department", Op: OpNe, Value: "sales"}},
+		Email{ID: "archive", To: "archive@example.com", From: "b@example.com"},
+	)
+	form.AutoReply = &AutoReply{Field: "email", Email: Email{ID: "reply", From: "b@example.com", Condition: &Condition{Field: "newsletter", Op: OpNotEmpty}}}
+
+	s := &Submission{Form: form, Values: map[string]interface{}{"department": "sales", "email": "person@example.com"}}
+	selected, err := s.Selected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 2 || selected[0].ID != "sales" || selected[1].ID != "archive" {
+		t.Errorf("Unexpected selected emails: %+v", selected)
+	}
+
+	if err := s.Send(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(sent, ",") != "sales,archive" {
+		t.Errorf("Unexpected sends \nExpected: sales,archive; Got: %v", sent)
+	}
+
+	sent = nil
+	s.Values["department"] = "other"
+	s.Values["newsletter"] = "yes"
+	if err := s.Send(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(sent, ",") != "support,archive,reply" {
+		t.Errorf("Unexpected sends \nExpected: support,archive,reply; Got: %v", sent)
+	}
+	results, err := s.Deliver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var delivered []string
+	for _, r := range results {
+		delivered = append(delivered, r.ID)
+	}
+	if strings.Join(delivered, ",") != "support,archive,reply" || !results[2].AutoReply {
+		t.Errorf("Unexpected results \nExpected: support,archive,reply; Got: %+v", results)
+	}
+}
@@ -0,0 +1,430 @@
+package formailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config file formats supported by LoadConfig.
+const (
+	ConfigYAML = "yaml"
+	ConfigJSON = "json"
+	ConfigTOML = "toml"
+)
+
+// fileConfig is the layout of a config file
+type fileConfig struct {
+	Forms []formConfig `yaml:"forms"`
+}
+
+type formConfig struct {
+	line int
+
+	ID          string           `yaml:"id"`
+	Name        string           `yaml:"name"`
+	Redirect    string           `yaml:"redirect"`
+	Ignore      []string         `yaml:"ignore"`
+	Honeypot    []string         `yaml:"honeypot"`
+	ThreadField string           `yaml:"thread_field"`
+	Concurrency int              `yaml:"concurrency"`
+	RateLimit   RateLimit        `yaml:"rate_limit"`
+	Attachments AttachmentLimits `yaml:"attachments"`
+	Captcha     captchaConfig    `yaml:"captcha"`
+	Rules       map[string]Rule  `yaml:"rules"`
+	Emails      []emailConfig    `yaml:"emails"`
+	AutoReply   *autoReplyConfig `yaml:"auto_reply"`
+}
+
+type captchaConfig struct {
+	Provider  string   `yaml:"provider"`
+	MinScore  float64  `yaml:"min_score"`
+	Action    string   `yaml:"action"`
+	Hostnames []string `yaml:"hostnames"`
+	SpamTag   string   `yaml:"spam_tag"`
+}
+
+type emailConfig struct {
+	line int
+
+	ID           string   `yaml:"id"`
+	To           string   `yaml:"to"`
+	From         string   `yaml:"from"`
+	Cc           []string `yaml:"cc"`
+	Bcc          []string `yaml:"bcc"`
+	ReplyTo      string   `yaml:"reply_to"`
+	Subject      string   `yaml:"subject"`
+	Template     string   `yaml:"template"`
+	TextTemplate string   `yaml:"text_template"`
+
+	Headers   map[string]string `yaml:"headers"`
+	Priority  string            `yaml:"priority"`
+	Tags      []string          `yaml:"tags"`
+	Condition *Condition        `yaml:"condition"`
+	Retry     *RetryPolicy      `yaml:"retry"`
+}
+
+type autoReplyConfig struct {
+	emailConfig `yaml:",inline"`
+	Field       string `yaml:"field"`
+}
+
+func (f *formConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain formConfig
+	f.line = value.Line
+	return value.Decode((*plain)(f))
+}
+
+func (e *emailConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain emailConfig
+	e.line = value.Line
+	return value.Decode((*plain)(e))
+}
+
+func (a *autoReplyConfig) UnmarshalYAML(value *yaml.Node) error {
+	err := value.Decode(&a.emailConfig)
+	if err != nil {
+		return err
+	}
+
+	var field struct {
+		Field string `yaml:"field"`
+	}
+	err = value.Decode(&field)
+	a.Field = field.Field
+	return err
+}
+
+// LoadConfigFile reads a config file from fsys choosing the format based on the file extension.
+// Template paths are relative to the config file.
+func LoadConfigFile(fsys fs.FS, name string) (Config, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	templates, err := fs.Sub(fsys, path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadConfig(file, strings.TrimPrefix(path.Ext(name), "."), templates)
+}
+
+// LoadConfig reads forms from r in the given format: ConfigYAML, ConfigJSON, or ConfigTOML.
+// Templates referenced by emails are read from templates, which can be nil when no templates are used.
+// Unknown keys are an error and every error includes the line number it was found on.
+// Settings like rules, conditions, retries and limits use the keys in the yaml tags of their types, with durations written like 500ms or 24h.
+func LoadConfig(r io.Reader, format string, templates fs.FS) (Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var node *yaml.Node
+	switch strings.ToLower(format) {
+	case ConfigYAML, "yml":
+		node, err = yamlNode(data)
+	case ConfigJSON:
+		node, err = jsonNode(data)
+	case ConfigTOML:
+		node, err = tomlNode(data)
+	default:
+		err = fmt.Errorf("unsupported config format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file fileConfig
+	if err := knownFields(node, reflect.TypeOf(file)); err != nil {
+		return nil, err
+	}
+	if err := node.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	return file.config(templates)
+}
+
+func yamlNode(data []byte) (*yaml.Node, error) {
+	node := new(yaml.Node)
+	if err := yaml.Unmarshal(data, node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// jsonNode validates the document as JSON then parses it as YAML, which JSON is a subset of, to keep line numbers
+func jsonNode(data []byte) (*yaml.Node, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return nil, fmt.Errorf("line %d: %w", lineAt(data, int(syntax.Offset)), err)
+		}
+		return nil, err
+	}
+	return yamlNode(bytes.ReplaceAll(data, []byte{'\t'}, []byte{' '}))
+}
+
+func lineAt(data []byte, offset int) int {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	return bytes.Count(data[:offset], []byte{'\n'}) + 1
+}
+
+// knownFields returns an error for the first key in node that doesn't match a field of t
+func knownFields(node *yaml.Node, t reflect.Type) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			if err := knownFields(n, t); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		if t.Kind() != reflect.Slice {
+			return nil
+		}
+		for _, n := range node.Content {
+			if err := knownFields(n, t.Elem()); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		if t.Kind() == reflect.Map {
+			for i := 1; i < len(node.Content); i += 2 {
+				if err := knownFields(node.Content[i], t.Elem()); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			field, ok := fields[key.Value]
+			if !ok {
+				return fmt.Errorf("line %d: unknown key %q", key.Line, key.Value)
+			}
+			if err := knownFields(node.Content[i+1], field); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// yamlFields maps the yaml keys of a struct to their types including inlined structs
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("yaml")
+		name, opts, _ := strings.Cut(tag, ",")
+		if opts == "inline" {
+			for k, v := range yamlFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		fields[or(name, strings.ToLower(f.Name))] = f.Type
+	}
+	return fields
+}
+
+// config builds and validates the forms collecting every error
+func (f *fileConfig) config(templates fs.FS) (Config, error) {
+	c := make(Config)
+	var errs []error
+
+	for _, fc := range f.Forms {
+		form, err := fc.form(templates)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		id := strings.ToLower(or(form.ID, form.Name))
+		if _, exists := c[id]; exists {
+			errs = append(errs, fmt.Errorf("line %d: duplicate form %q", fc.line, id))
+			continue
+		}
+		c.Add(form)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return c, nil
+}
+
+func (fc *formConfig) form(templates fs.FS) (*Form, error) {
+	var errs []error
+	if len(fc.ID) < 1 && len(fc.Name) < 1 {
+		errs = append(errs, fmt.Errorf("line %d: form is missing id or name", fc.line))
+	}
+	if err := fc.RateLimit.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("line %d: %w", fc.line, err))
+	}
+	if err := fc.Attachments.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("line %d: %w", fc.line, err))
+	}
+	for field, rule := range fc.Rules {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: invalid pattern for rule %s: %w", fc.line, field, err))
+		}
+	}
+
+	form := newForm(fc.ID)
+	form.Name = fc.Name
+	form.Redirect = fc.Redirect
+	form.Honeypot = fc.Honeypot
+	form.ThreadField = fc.ThreadField
+	form.Concurrency = fc.Concurrency
+	form.RateLimit = fc.RateLimit
+	form.AttachmentLimits = fc.Attachments
+	form.Rules = fc.Rules
+	form.Captcha = strings.ToLower(fc.Captcha.Provider)
+	form.CaptchaMinScore = fc.Captcha.MinScore
+	form.CaptchaAction = fc.Captcha.Action
+	form.CaptchaHostnames = fc.Captcha.Hostnames
+	form.CaptchaSpamTag = fc.Captcha.SpamTag
+	form.Ignore(fc.Ignore...)
+
+	for _, ec := range fc.Emails {
+		if len(ec.To) < 1 {
+			errs = append(errs, fmt.Errorf("line %d: email is missing to", ec.line))
+		}
+		email, err := ec.email(templates)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		form.AddEmail(email)
+	}
+
+	if fc.AutoReply != nil {
+		if len(fc.AutoReply.Field) < 1 {
+			errs = append(errs, fmt.Errorf("line %d: auto_reply is missing field", fc.AutoReply.line))
+		}
+		email, err := fc.AutoReply.email(templates)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		form.AutoReply = &AutoReply{Email: email, Field: fc.AutoReply.Field}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return form, nil
+}
+
+func (ec *emailConfig) email(templates fs.FS) (Email, error) {
+	email := Email{
+		ID:        ec.ID,
+		To:        ec.To,
+		From:      ec.From,
+		Cc:        ec.Cc,
+		Bcc:       ec.Bcc,
+		ReplyTo:   ec.ReplyTo,
+		Subject:   ec.Subject,
+		Headers:   ec.Headers,
+		Priority:  Priority(strings.ToLower(ec.Priority)),
+		Tags:      ec.Tags,
+		Condition: ec.Condition,
+		Retry:     ec.Retry,
+	}
+
+	var errs []error
+	if len(ec.From) < 1 {
+		errs = append(errs, fmt.Errorf("line %d: email is missing from", ec.line))
+	}
+
+	for name, text := range map[string]string{"To": ec.To, "From": ec.From, "ReplyTo": ec.ReplyTo, "Subject": ec.Subject} {
+		if _, err := texttemplate.New(name).Funcs(templateFuncMap).Parse(text); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", ec.line, err))
+		}
+	}
+	for name, text := range ec.Headers {
+		if err := validateHeader(name); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", ec.line, err))
+			continue
+		}
+		if _, err := texttemplate.New(name).Funcs(templateFuncMap).Parse(text); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", ec.line, err))
+		}
+	}
+	if err := validatePriority(email.Priority); err != nil {
+		errs = append(errs, fmt.Errorf("line %d: %w", ec.line, err))
+	}
+	if ec.Condition != nil {
+		if err := ec.Condition.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", ec.line, err))
+		}
+	}
+	if ec.Retry != nil && (ec.Retry.Jitter < 0 || ec.Retry.Jitter > 1) {
+		errs = append(errs, fmt.Errorf("line %d: retry jitter must be between 0 and 1", ec.line))
+	}
+
+	var err error
+	if len(ec.Template) > 0 {
+		email.Template, err = readTemplate(templates, ec.Template)
+		if err == nil {
+			_, err = template.New("email").Funcs(templateFuncMap).Parse(email.Template)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: invalid template: %w", ec.line, err))
+		}
+	}
+	if len(ec.TextTemplate) > 0 {
+		email.TextTemplate, err = readTemplate(templates, ec.TextTemplate)
+		if err == nil {
+			_, err = texttemplate.New("text").Funcs(templateFuncMap).Parse(email.TextTemplate)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: invalid text_template: %w", ec.line, err))
+		}
+	}
+
+	return email, errors.Join(errs...)
+}
+
+func readTemplate(templates fs.FS, name string) (string, error) {
+	if templates == nil {
+		return "", fmt.Errorf("cannot read %s without a templates filesystem", name)
+	}
+
+	b, err := fs.ReadFile(templates, name)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,199 @@
+package formailer
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testConfigFiles = fstest.MapFS{
+	"templates/contact.html": {Data: []byte(`<p>{{first .Values.message}}</p>`)},
+	"templates/contact.txt":  {Data: []byte(`{{first .Values.message}}`)},
+	"forms.yaml": {Data: []byte(`
+forms:
+  - id: contact
+    name: Contact
+    redirect: /thanks
+    honeypot: [website]
+    thread_field: email
+    rate_limit: {per_ip: {requests: 5, period: 1h}}
+    attachments: {max_file_size: 1048576, mime_types: [application/pdf, image/*]}
+    ignore: [internal]
+    captcha:
+      provider: Turnstile
+      min_score: 0.5
+    rules:
+      email: {required: true, email: true}
+      age: {min: 18}
+    emails:
+      - id: sales
+        to: sales@example.com
+        from: noreply@example.com
+        subject: New contact from {{first .Values.name}}
+        condition: {field: department, value: sales}
+        retry: {max_attempts: 3, base_delay: 500ms}
+        template: templates/contact.html
+        text_template: templates/contact.txt
+    auto_reply:
+      field: email
+      from: noreply@example.com
+      subject: Thanks
+`)},
+	"forms.json": {Data: []byte(`{
+	"forms": [{
+		"id": "contact",
+		"name": "Contact",
+		"redirect": "/thanks",
+		"honeypot": ["website"],
+		"thread_field": "email",
+		"rate_limit": {"per_ip": {"requests": 5, "period": "1h"}},
+		"attachments": {"max_file_size": 1048576, "mime_types": ["application/pdf", "image/*"]},
+		"ignore": ["internal"],
+		"captcha": {"provider": "Turnstile", "min_score": 0.5},
+		"rules": {"email": {"required": true, "email": true}, "age": {"min": 18}},
+		"emails": [{
+			"id": "sales",
+			"to": "sales@example.com",
+			"from": "noreply@example.com",
+			"subject": "New contact from {{first .Values.name}}",
+			"condition": {"field": "department", "value": "sales"},
+			"retry": {"max_attempts": 3, "base_delay": "500ms"},
+			"template": "templates/contact.html",
+			"text_template": "templates/contact.txt"
+		}],
+		"auto_reply": {"field": "email", "from": "noreply@example.com", "subject": "Thanks"}
+	}]
+}`)},
+	"forms.toml": {Data: []byte(`
+[[forms]]
+id = "contact"
+name = "Contact"
+redirect = "/thanks"
+honeypot = ["website"]
+thread_field = "email"
+rate_limit = { per_ip = { requests = 5, period = "1h" } }
+attachments = { max_file_size = 1048576, mime_types = ["application/pdf", "image/*"] }
+ignore = ["internal"]
+captcha = { provider = "Turnstile", min_score = 0.5 }
+
+[forms.rules]
+email = { required = true, email = true }
+age.min = 18
+
+[[forms.emails]]
+id = "sales"
+to = "sales@example.com"
+from = "noreply@example.com"
+subject = "New contact from {{first .Values.name}}"
+condition = { field = "department", value = "sales" }
+retry = { max_attempts = 3, base_delay = "500ms" }
+template = "templates/contact.html"
+text_template = "templates/contact.txt"
+
+[forms.auto_reply]
+field = "email"
+from = "noreply@example.com"
+subject = "Thanks"
+`)},
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	for _, name := range []string{"forms.yaml", "forms.json", "forms.toml"} {
+		c, err := LoadConfigFile(testConfigFiles, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		form, ok := c["contact"]
+		if !ok {
+			t.Fatalf("%s: missing contact form", name)
+		}
+		if form.Name != "Contact" || form.Redirect != "/thanks" || form.Captcha != CaptchaTurnstile || form.CaptchaMinScore != 0.5 {
+			t.Errorf("%s: unexpected form settings %+v", name, form)
+		}
+		if !form.ignore["internal"] || !form.ignore["_form_name"] || !contains(form.Honeypot, "website") || form.ThreadField != "email" {
+			t.Errorf("%s: unexpected ignored fields %v %v", name, form.ignore, form.Honeypot)
+		}
+		if form.RateLimit.PerIP != (Limit{Requests: 5, Period: time.Hour}) || form.RateLimit.PerForm.Enabled() {
+			t.Errorf("%s: unexpected rate limit %+v", name, form.RateLimit)
+		}
+		if form.AttachmentLimits.MaxFileSize != 1<<20 || !cmp.Equal(form.AttachmentLimits.MimeTypes, []string{"application/pdf", "image/*"}) {
+			t.Errorf("%s: unexpected attachment limits %+v", name, form.AttachmentLimits)
+		}
+		if !form.Rules["email"].Email || form.Rules["age"].Min == nil || *form.Rules["age"].Min != 18 {
+			t.Errorf("%s: unexpected rules %+v", name, form.Rules)
+		}
+		if len(form.Emails) != 1 {
+			t.Fatalf("%s: expected 1 email; Got: %d", name, len(form.Emails))
+		}
+
+		email := form.Emails[0]
+		if email.Condition == nil || email.Condition.Field != "department" || email.Condition.Value != "sales" {
+			t.Errorf("%s: unexpected condition %+v", name, email.Condition)
+		}
+		if email.Retry == nil || email.Retry.MaxAttempts != 3 || email.Retry.BaseDelay != 500*time.Millisecond {
+			t.Errorf("%s: unexpected retry policy %+v", name, email.Retry)
+		}
+		if email.ID != "sales" || email.To != "sales@example.com" || email.Template != `<p>{{first .Values.message}}</p>` || email.TextTemplate != `{{first .Values.message}}` {
+			t.Errorf("%s: unexpected email %+v", name, email)
+		}
+		if form.AutoReply == nil || form.AutoReply.Field != "email" || form.AutoReply.Subject != "Thanks" {
+			t.Errorf("%s: unexpected auto-reply %+v", name, form.AutoReply)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		format   string
+		config   string
+		expected []string
+	}{
+		{ConfigYAML, "forms:\n  - id: contact\n    redirct: /thanks\n", []string{`line 3: unknown key "redirct"`}},
+		{ConfigJSON, "{\n\"forms\": [{\n\t\"id\": \"contact\",\n\t\"emails\": [{\"to\": \"a@example.com\", \"form\": \"b@example.com\"}]\n}]\n}", []string{`line 4: unknown key "form"`}},
+		{ConfigJSON, "{\n\"forms\": [\n}", []string{"line 3:"}},
+		{ConfigTOML, "[[forms]]\nid = \"contact\"\n\n[[forms.emails]]\nto = \"a@example.com\"\nsubjct = \"Hi\"\n", []string{`line 6: unknown key "subjct"`}},
+		{ConfigTOML, "[[forms]]\nid = \"contact\"\nid = \"again\"\n", []string{`line 3: duplicate key "id"`}},
+		{ConfigYAML, "forms:\n  - id: contact\n    emails:\n      - subject: '{{.Values'\n  - name: Contact\n  - name: contact\n", []string{
+			"line 4: email is missing to",
+			"line 4: email is missing from",
+			"line 4: template:",
+			`line 6: duplicate form "contact"`,
+		}},
+		{ConfigYAML, "forms:\n  - redirect: /thanks\n    emails:\n      - to: a@example.com\n        from: b@example.com\n        template: missing.html\n", []string{
+			"line 2: form is missing id or name",
+			"line 4: invalid template",
+		}},
+		{ConfigYAML, "forms:\n  - id: contact\n    emails:\n      - to: a@example.com\n        from: b@example.com\n        priority: urgent\n        headers: {Message-Id: abc, 'Bad Name': x}\n", []string{
+			"line 4: header Message-Id can't be set",
+			`line 4: invalid header name "Bad Name"`,
+			`line 4: invalid priority "urgent"`,
+		}},
+		{ConfigYAML, "forms:\n  - id: contact\n    emails:\n      - to: a@example.com\n        from: b@example.com\n        condition: {field: department, op: is}\n", []string{
+			`line 4: invalid condition op "is"`,
+		}},
+		{ConfigYAML, "forms:\n  - id: contact\n    rate_limit: {per_form: {requests: 10}}\n", []string{
+			"line 2: per_form rate limit of 10 requests is missing period",
+		}},
+		{ConfigYAML, "forms:\n  - id: contact\n    attachments: {max_count: -1}\n  - id: upload\n    attachments: {mime_types: [pdf]}\n", []string{
+			"line 2: attachment limits can't be negative",
+			`line 4: invalid attachment mime type "pdf"`,
+		}},
+	}
+
+	for _, test := range tests {
+		_, err := LoadConfig(strings.NewReader(test.config), test.format, testConfigFiles)
+		if err == nil {
+			t.Errorf("Expected error loading %s config\n%s", test.format, test.config)
+			continue
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected error to contain %q; Got: %v", expected, err)
+			}
+		}
+	}
+}
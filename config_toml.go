@@ -0,0 +1,186 @@
+package formailer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// tomlNode converts a TOML document into a yaml.Node tree so every format shares the same decoding and line numbers
+func tomlNode(data []byte) (*yaml.Node, error) {
+	p := new(unstable.Parser)
+	p.Reset(data)
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1}
+	table := root
+	for p.NextExpression() {
+		var err error
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.KeyValue:
+			err = tomlSet(p, table, expr)
+		case unstable.Table:
+			table, err = tomlTable(p, root, tomlKeys(p, expr.Key()), false)
+		case unstable.ArrayTable:
+			table, err = tomlTable(p, root, tomlKeys(p, expr.Key()), true)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var perr *unstable.ParserError
+	if errors.As(p.Error(), &perr) {
+		return nil, fmt.Errorf("line %d: %s", p.Shape(p.Range(perr.Highlight)).Start.Line, perr.Message)
+	}
+	if p.Error() != nil {
+		return nil, p.Error()
+	}
+
+	return &yaml.Node{Kind: yaml.DocumentNode, Line: 1, Content: []*yaml.Node{root}}, nil
+}
+
+type tomlKey struct {
+	name string
+	line int
+}
+
+func tomlKeys(p *unstable.Parser, it unstable.Iterator) []tomlKey {
+	var keys []tomlKey
+	for it.Next() {
+		n := it.Node()
+		keys = append(keys, tomlKey{name: string(n.Data), line: p.Shape(n.Raw).Start.Line})
+	}
+	return keys
+}
+
+func tomlKeyNode(key tomlKey) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.name, Line: key.line}
+}
+
+// tomlChild returns the value stored under name in a mapping node or nil
+func tomlChild(mapping *yaml.Node, name string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == name {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// tomlDescend walks through tables creating any that are missing. Arrays of tables resolve to their last table.
+func tomlDescend(mapping *yaml.Node, keys []tomlKey) (*yaml.Node, error) {
+	for _, key := range keys {
+		child := tomlChild(mapping, key.name)
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.line}
+			mapping.Content = append(mapping.Content, tomlKeyNode(key), child)
+		}
+		if child.Kind == yaml.SequenceNode && len(child.Content) > 0 {
+			child = child.Content[len(child.Content)-1]
+		}
+		if child.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: key %q is not a table", key.line, key.name)
+		}
+		mapping = child
+	}
+	return mapping, nil
+}
+
+// tomlTable returns the table for a [table] or [[array]] header
+func tomlTable(p *unstable.Parser, root *yaml.Node, keys []tomlKey, array bool) (*yaml.Node, error) {
+	if !array {
+		return tomlDescend(root, keys)
+	}
+
+	parent, err := tomlDescend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	key := keys[len(keys)-1]
+	seq := tomlChild(parent, key.name)
+	if seq == nil {
+		seq = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: key.line}
+		parent.Content = append(parent.Content, tomlKeyNode(key), seq)
+	}
+	if seq.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("line %d: key %q is not an array of tables", key.line, key.name)
+	}
+
+	table := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.line}
+	seq.Content = append(seq.Content, table)
+	return table, nil
+}
+
+// tomlSet adds a key value expression to the table
+func tomlSet(p *unstable.Parser, table *yaml.Node, expr *unstable.Node) error {
+	keys := tomlKeys(p, expr.Key())
+	parent, err := tomlDescend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+
+	key := keys[len(keys)-1]
+	if tomlChild(parent, key.name) != nil {
+		return fmt.Errorf("line %d: duplicate key %q", key.line, key.name)
+	}
+
+	value, err := tomlValue(p, expr.Value(), key.line)
+	if err != nil {
+		return err
+	}
+	parent.Content = append(parent.Content, tomlKeyNode(key), value)
+	return nil
+}
+
+func tomlValue(p *unstable.Parser, n *unstable.Node, line int) (*yaml.Node, error) {
+	scalar := func(tag, value string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value, Line: line}
+	}
+
+	switch n.Kind {
+	case unstable.String:
+		return scalar("!!str", string(n.Data)), nil
+	case unstable.Bool:
+		return scalar("!!bool", string(n.Data)), nil
+	case unstable.Integer:
+		return scalar("!!int", strings.ReplaceAll(string(n.Data), "_", "")), nil
+	case unstable.Float:
+		value := strings.ReplaceAll(string(n.Data), "_", "")
+		switch strings.TrimLeft(value, "+-") {
+		case "inf":
+			value = strings.TrimSuffix(value, "inf") + ".inf"
+		case "nan":
+			value = ".nan"
+		}
+		return scalar("!!float", value), nil
+	case unstable.LocalDate, unstable.LocalTime, unstable.LocalDateTime, unstable.DateTime:
+		return scalar("!!str", string(n.Data)), nil
+	case unstable.Array:
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line}
+		it := n.Children()
+		for it.Next() {
+			v, err := tomlValue(p, it.Node(), line)
+			if err != nil {
+				return nil, err
+			}
+			seq.Content = append(seq.Content, v)
+		}
+		return seq, nil
+	case unstable.InlineTable:
+		table := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line}
+		it := n.Children()
+		for it.Next() {
+			if err := tomlSet(p, table, it.Node()); err != nil {
+				return nil, err
+			}
+		}
+		return table, nil
+	}
+
+	return nil, fmt.Errorf("line %d: unsupported value %s", line, n.Kind)
+}
@@ -0,0 +1,78 @@
+package formailer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/toorop/go-dkim"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// dkimHeaders are signed when DKIM_HEADERS isn't set. Missing headers are signed as empty so they can't be added later.
+var dkimHeaders = []string{"From", "To", "Cc", "Reply-To", "Subject", "Date", "Message-Id", "Mime-Version", "Content-Type"}
+
+// dkimOptions reads the DKIM settings for the email from the environment. ok is false when signing isn't configured.
+// Signing is turned on by setting DKIM_SELECTOR and the key is read from DKIM_PRIVATE_KEY or DKIM_PRIVATE_KEY_FILE.
+func (e *Email) dkimOptions(from string) (options dkim.SigOptions, ok bool, err error) {
+	selector := e.env("DKIM", "SELECTOR")
+	if len(selector) < 1 {
+		return options, false, nil
+	}
+
+	key := e.env("DKIM", "PRIVATE_KEY")
+	if len(key) < 1 {
+		file := e.env("DKIM", "PRIVATE_KEY_FILE")
+		if len(file) < 1 {
+			prefix := fmt.Sprintf("DKIM_%s_", strings.ToUpper(e.ID))
+			return options, false, fmt.Errorf("incomplete DKIM configuration missing %[1]sPRIVATE_KEY, %[1]sPRIVATE_KEY_FILE, DKIM_PRIVATE_KEY or DKIM_PRIVATE_KEY_FILE for %[2]s", prefix, e.ID)
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return options, false, fmt.Errorf("failed to read DKIM private key: %w", err)
+		}
+		key = string(b)
+	}
+	// Env vars often can't hold line breaks so allow them to be escaped
+	key = strings.ReplaceAll(key, `\n`, "\n")
+
+	domain := e.env("DKIM", "DOMAIN")
+	if len(domain) < 1 {
+		domain = addressDomain(from)
+	}
+
+	headers := dkimHeaders
+	if h := e.env("DKIM", "HEADERS"); len(h) > 0 {
+		headers = nil
+		for _, header := range strings.Split(h, ",") {
+			if header = strings.TrimSpace(header); len(header) > 0 {
+				headers = append(headers, header)
+			}
+		}
+	}
+
+	options = dkim.NewSigOptions()
+	options.PrivateKey = []byte(key)
+	options.Domain = domain
+	options.Selector = selector
+	options.Canonicalization = "relaxed/relaxed"
+	options.Headers = append([]string(nil), headers...)
+	return options, true, nil
+}
+
+// sign adds a DKIM signature to the email when DKIM is configured. It must be called after every header has been set.
+func (e *Email) sign(email *mail.Email) error {
+	if email.GetError() != nil {
+		return email.GetError()
+	}
+
+	options, ok, err := e.dkimOptions(email.GetFrom())
+	if err != nil || !ok {
+		return err
+	}
+
+	if err := email.SetDkim(options).GetError(); err != nil {
+		return fmt.Errorf("failed to sign message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package formailer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/toorop/go-dkim"
+)
+
+// testDKIMKey returns a PEM encoded private key and the DNS record for its public key
+func testDKIMKey(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	private := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return string(private), "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(public)
+}
+
+func verifyDKIM(t *testing.T, msg, record string) {
+	t.Helper()
+	b := []byte(msg)
+	lookup := dkim.DNSOptLookupTXT(func(name string) ([]string, error) {
+		if name != "formailer._domainkey.example.com" {
+			t.Errorf("Unexpected DKIM lookup \nExpected: formailer._domainkey.example.com; Got: %s", name)
+		}
+		return []string{record}, nil
+	})
+	status, err := dkim.Verify(&b, lookup)
+	if err != nil || status != dkim.SUCCESS {
+		t.Errorf("Expected a valid DKIM signature; Got: %v %v", status, err)
+	}
+}
+
+func TestDKIM(t *testing.T) {
+	private, record := testDKIMKey(t)
+	t.Setenv("DKIM_SELECTOR", "formailer")
+	t.Setenv("DKIM_PRIVATE_KEY", strings.ReplaceAll(private, "\n", `\n`))
+
+	e := &Email{ID: "dkim", To: "to@example.com", From: `"Forms" <forms@example.com>`, Subject: "Signed"}
+	s := &Submission{Form: testForm, Values: map[string]interface{}{"message": "Hello"}}
+	email, err := e.Email(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(email.DkimMsg, "DKIM-Signature:") || !strings.Contains(email.DkimMsg, "d=example.com") {
+		t.Fatalf("Expected message to be signed for example.com; Got: %.200s", email.DkimMsg)
+	}
+	verifyDKIM(t, rawMessage(email), record)
+
+	server := newFakeSMTP(t)
+	server.Setenv(t, "dkim")
+	t.Setenv("SMTP_DKIM_AUTH", "none")
+	if err := (SMTPSender{}).Send(e, email); err != nil {
+		t.Fatal(err)
+	}
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message; Got: %d", len(messages))
+	}
+	verifyDKIM(t, messages[0].Data, record)
+
+	m, err := parseMessage(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Headers["Dkim-Signature"]; ok {
+		t.Error("Expected DKIM signature to be left out of parsed headers")
+	}
+}
+
+func TestDKIMSettings(t *testing.T) {
+	private, _ := testDKIMKey(t)
+	file := filepath.Join(t.TempDir(), "dkim.pem")
+	if err := os.WriteFile(file, []byte(private), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Email{ID: "settings"}
+	if _, ok, err := e.dkimOptions("forms@example.com"); ok || err != nil {
+		t.Errorf("Expected signing to be off without a selector; Got: %v %v", ok, err)
+	}
+
+	t.Setenv("DKIM_SETTINGS_SELECTOR", "s1")
+	if _, _, err := e.dkimOptions("forms@example.com"); err == nil || !strings.Contains(err.Error(), "DKIM_SETTINGS_PRIVATE_KEY") {
+		t.Errorf("Expected missing private key error; Got: %v", err)
+	}
+
+	t.Setenv("DKIM_SETTINGS_PRIVATE_KEY_FILE", file)
+	t.Setenv("DKIM_SETTINGS_DOMAIN", "mail.example.com")
+	t.Setenv("DKIM_SETTINGS_HEADERS", "From, Subject,")
+	options, ok, err := e.dkimOptions("forms@example.com")
+	if err != nil || !ok {
+		t.Fatalf("Unexpected DKIM settings error: %v", err)
+	}
+	if options.Domain != "mail.example.com" || options.Selector != "s1" || strings.Join(options.Headers, ",") != "From,Subject" || string(options.PrivateKey) != private {
+		t.Errorf("Unexpected DKIM options: %+v", options)
+	}
+
+	t.Setenv("DKIM_SETTINGS_PRIVATE_KEY_FILE", "")
+	t.Setenv("DKIM_SETTINGS_PRIVATE_KEY", "not a key")
+	if _, err := (&Email{ID: "settings", To: "to@example.com", From: "forms@example.com"}).Email(&Submission{Form: testForm}); err == nil || !strings.Contains(err.Error(), "failed to sign message") {
+		t.Errorf("Expected signing error; Got: %v", err)
+	}
+}
@@ -3,12 +3,14 @@ package formailer
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/base32"
 	"fmt"
 	"html/template"
 	"os"
 	"strconv"
 	"strings"
+	texttemplate "text/template"
 	"time"
 
 	// embed is used to embed the default template file
@@ -21,12 +23,17 @@ import (
 //go:embed template.html
 var defaultTemplate string
 
+//go:embed template.txt
+var defaultTextTemplate string
+
 // Email contains all the setting to send an email
 type Email struct {
 	// ID is used when looking up SMTP settings.
 	// It is case-insensitive but will be matched as UPPERCASE. ex: SMTP_FORM-ID_HOST.
 	ID string
 
+	// To, From, ReplyTo and Subject are go text templates rendered against the Submission. ex: "New quote from {{first .Values.name}}".
+	// Line breaks are removed and addresses must render to a single valid address. When ReplyTo renders empty it is left out.
 	To      string
 	From    string
 	Cc      []string
@@ -36,6 +43,28 @@ type Email struct {
 
 	// Template is a go html template to be used when generating the email.
 	Template string
+
+	// TextTemplate is a go text template used to generate the plain text alternative of the email.
+	TextTemplate string
+
+	// Headers are extra headers like List-Unsubscribe. Values are go text templates rendered against the Submission and headers rendering empty are left out.
+	// Headers Formailer sets itself, such as Message-Id, are refused.
+	Headers map[string]string
+
+	// Priority sets the X-Priority and Importance headers.
+	Priority Priority
+
+	// Tags are sent as X-Mailgun-Tag and X-PM-Tag headers for provider analytics. Only the first tag fits in the headers.
+	Tags []string
+
+	// Condition decides whether the email is sent for a submission. When nil the email is always sent.
+	Condition *Condition
+
+	// Retry retries transient delivery failures. When nil the email is only tried once.
+	Retry *RetryPolicy
+
+	// Sender delivers the email. When nil the Form's Sender is used, then the Config's, then DefaultSender.
+	Sender Sender
 }
 
 func or(a, b string) string {
@@ -50,15 +79,90 @@ func (e *Email) template() string {
 	return or(e.Template, defaultTemplate)
 }
 
+// textTemplate allows for fallback on the default text template when no text template has been provided
+func (e *Email) textTemplate() string {
+	return or(e.TextTemplate, defaultTextTemplate)
+}
+
+// smtpEncryption maps SMTP_ENCRYPTION values to encryption types.
+// tls means STARTTLS like the original EncryptionTLS default, use ssl for implicit TLS.
+var smtpEncryption = map[string]mail.Encryption{
+	"none":     mail.EncryptionNone,
+	"ssl":      mail.EncryptionSSLTLS,
+	"tls":      mail.EncryptionSTARTTLS,
+	"starttls": mail.EncryptionSTARTTLS,
+}
+
+// smtpAuth maps SMTP_AUTH values to authentication types
+var smtpAuth = map[string]mail.AuthType{
+	"none":     mail.AuthNone,
+	"plain":    mail.AuthPlain,
+	"login":    mail.AuthLogin,
+	"cram-md5": mail.AuthCRAMMD5,
+	"auto":     mail.AuthAuto,
+}
+
+// smtpEnv returns a setting for the email falling back on the default, along with the variable it was read from
+func (e *Email) smtpEnv(key string) (string, string) {
+	name := fmt.Sprintf("SMTP_%s_%s", strings.ToUpper(e.ID), key)
+	if v := os.Getenv(name); len(v) > 0 {
+		return v, name
+	}
+	return os.Getenv("SMTP_" + key), "SMTP_" + key
+}
+
+// smtpDuration parses a timeout setting as a duration like 30s or a number of seconds
+func (e *Email) smtpDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v, name := e.smtpEnv(key)
+	if len(v) < 1 {
+		return fallback, nil
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %s: %w", name, err)
+	}
+	return d, nil
+}
+
 // server returns a sever using the ENV for auth falling back on the default for each missing param
 func (e *Email) server() (*mail.SMTPServer, error) {
 	prefix := fmt.Sprintf("SMTP_%s_", strings.ToUpper(e.ID))
-	host := or(os.Getenv(prefix+"HOST"), os.Getenv("SMTP_HOST"))
-	user := or(os.Getenv(prefix+"USER"), os.Getenv("SMTP_USER"))
-	pass := or(os.Getenv(prefix+"PASS"), os.Getenv("SMTP_PASS"))
-	defaultPort := os.Getenv("SMTP_PORT")
-	emailPort := os.Getenv(prefix + "PORT")
-	stringPort := or(emailPort, defaultPort)
+	host, _ := e.smtpEnv("HOST")
+	user, _ := e.smtpEnv("USER")
+	pass, _ := e.smtpEnv("PASS")
+	stringPort, portName := e.smtpEnv("PORT")
+	encryption, encryptionName := e.smtpEnv("ENCRYPTION")
+	auth, authName := e.smtpEnv("AUTH")
+	helo, _ := e.smtpEnv("HELO")
+	skipVerify, skipVerifyName := e.smtpEnv("INSECURE_SKIP_VERIFY")
+
+	server := mail.NewSMTPClient()
+	server.Encryption = mail.EncryptionSTARTTLS
+	server.Authentication = mail.AuthLogin
+
+	if len(encryption) > 0 {
+		t, ok := smtpEncryption[strings.ToLower(encryption)]
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %q must be one of none, ssl, tls or starttls", encryptionName, encryption)
+		}
+		server.Encryption = t
+	}
+	xoauth2 := strings.EqualFold(auth, "xoauth2")
+	if len(auth) > 0 && !xoauth2 {
+		t, ok := smtpAuth[strings.ToLower(auth)]
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %q must be one of none, plain, login, cram-md5, auto or xoauth2", authName, auth)
+		}
+		server.Authentication = t
+	}
+	if xoauth2 {
+		// XOAUTH2 is handled by sendXOAUTH2 so go-simple-mail shouldn't authenticate
+		server.Authentication = mail.AuthNone
+	}
 
 	if len(host) < 1 {
 		return nil, fmt.Errorf("incomplete SMTP configuration missing %sHOST or SMTP_HOST for %s", prefix, e.ID)
@@ -66,31 +170,43 @@ func (e *Email) server() (*mail.SMTPServer, error) {
 	if len(stringPort) < 1 {
 		return nil, fmt.Errorf("incomplete SMTP configuration missing %sPORT or SMTP_PORT for %s", prefix, e.ID)
 	}
-	if len(user) < 1 {
-		return nil, fmt.Errorf("incomplete SMTP configuration missing %sUSER or SMTP_USER for %s", prefix, e.ID)
-	}
-	if len(pass) < 1 {
-		return nil, fmt.Errorf("incomplete SMTP configuration missing %sPASS or SMTP_PASS for %s", prefix, e.ID)
+	if server.Authentication != mail.AuthNone || xoauth2 {
+		if len(user) < 1 {
+			return nil, fmt.Errorf("incomplete SMTP configuration missing %sUSER or SMTP_USER for %s", prefix, e.ID)
+		}
+		if len(pass) < 1 && !xoauth2 {
+			return nil, fmt.Errorf("incomplete SMTP configuration missing %sPASS or SMTP_PASS for %s", prefix, e.ID)
+		}
 	}
 
 	port, err := strconv.Atoi(stringPort)
 	if err != nil {
-		if len(emailPort) < 1 {
-			prefix = "SMTP_"
+		return nil, fmt.Errorf("could not parse %s: %w", portName, err)
+	}
+
+	server.ConnectTimeout, err = e.smtpDuration("CONNECT_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	server.SendTimeout, err = e.smtpDuration("SEND_TIMEOUT", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(skipVerify) > 0 {
+		skip, err := strconv.ParseBool(skipVerify)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", skipVerifyName, err)
 		}
-		return nil, fmt.Errorf("could not parse %sPORT: %w", prefix, err)
+		server.TLSConfig = &tls.Config{ServerName: host, InsecureSkipVerify: skip}
 	}
 
-	server := mail.NewSMTPClient()
 	server.Host = host
 	server.Port = port
 	server.Username = user
 	server.Password = pass
-	server.Encryption = mail.EncryptionTLS
-	server.Authentication = mail.AuthLogin
+	server.Helo = helo
 	server.KeepAlive = false
-	server.ConnectTimeout = 10 * time.Second
-	server.SendTimeout = 10 * time.Minute
 
 	return server, nil
 }
@@ -111,6 +227,35 @@ func (e *Email) generate(s *Submission) (string, error) {
 	return inliner.Inline(email.String())
 }
 
+func (e *Email) generateText(s *Submission) (string, error) {
+	t := texttemplate.New("text").Funcs(templateFuncMap)
+	_, err := t.Parse(e.textTemplate())
+	if err != nil {
+		return "", err
+	}
+
+	var text bytes.Buffer
+	err = t.Execute(&text, s)
+	if err != nil {
+		return "", err
+	}
+
+	return text.String(), nil
+}
+
+// subject renders the subject prefixing the spam tag to suspected spam
+func (e *Email) subject(s *Submission) (string, error) {
+	subject, err := renderHeader("Subject", e.Subject, s)
+	if err != nil {
+		return "", err
+	}
+
+	if s.Spam && s.Form != nil && len(s.Form.CaptchaSpamTag) > 0 {
+		return s.Form.CaptchaSpamTag + " " + subject, nil
+	}
+	return subject, nil
+}
+
 // Email returns a *mail.Email generating the message with the provided submission
 func (e *Email) Email(submission *Submission) (*mail.Email, error) {
 	message, err := e.generate(submission)
@@ -118,20 +263,54 @@ func (e *Email) Email(submission *Submission) (*mail.Email, error) {
 		return nil, fmt.Errorf("failed to generate message: %w", err)
 	}
 
-	token := make([]byte, 32)
-	if _, err := rand.Read(token); err != nil {
-		return nil, fmt.Errorf("failed to generate message-id: %w", err)
+	text, err := e.generateText(submission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate text message: %w", err)
+	}
+
+	to, err := renderAddress("To", e.To, submission)
+	if err != nil {
+		return nil, err
+	}
+	from, err := renderAddress("From", e.From, submission)
+	if err != nil {
+		return nil, err
+	}
+	replyTo, err := renderAddress("Reply-To", e.ReplyTo, submission)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := e.subject(submission)
+	if err != nil {
+		return nil, err
 	}
 
 	email := mail.NewMSG()
-	email.AddTo(e.To)
-	email.SetFrom(e.From)
-	email.SetSubject(e.Subject)
-	email.SetBody(mail.TextHTML, message)
-	email.AddHeader("Message-Id", base32.StdEncoding.EncodeToString(token))
+	email.AddTo(to)
+	email.SetFrom(from)
+	email.SetSubject(subject)
+	email.SetBody(mail.TextPlain, text)
+	email.AddAlternative(mail.TextHTML, message)
+
+	domain := addressDomain(email.GetFrom())
+	id, err := randomID(20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate message-id: %w", err)
+	}
+	email.AddHeader("Message-Id", "<"+id+"@"+domain+">")
+	if len(submission.ID) > 0 {
+		email.AddHeader("X-Formailer-Submission-Id", submission.ID)
+	}
+	if thread := submission.threadID(domain); len(thread) > 0 {
+		email.AddHeader("In-Reply-To", thread)
+		email.AddHeader("References", thread)
+	}
+	if err := e.addHeaders(email, submission); err != nil {
+		return nil, err
+	}
 
-	if len(e.ReplyTo) > 0 {
-		email.SetReplyTo(e.ReplyTo)
+	if len(replyTo) > 0 {
+		email.SetReplyTo(replyTo)
 	}
 	for _, a := range e.Cc {
 		email.AddCc(a)
@@ -140,23 +319,42 @@ func (e *Email) Email(submission *Submission) (*mail.Email, error) {
 		email.AddBcc(a)
 	}
 	for _, attachment := range submission.Attachments {
-		email.AddAttachmentData(attachment.Data, attachment.Filename, attachment.MimeType)
+		if len(attachment.Path) > 0 {
+			email.Attach(&mail.File{FilePath: attachment.Path, Name: attachment.Filename, MimeType: attachment.MimeType})
+		} else {
+			email.AddAttachmentData(attachment.Data, attachment.Filename, attachment.MimeType)
+		}
 	}
 
+	if err := e.sign(email); err != nil {
+		return nil, err
+	}
 	return email, nil
 }
 
-// Send sends the provided email
-func (e *Email) Send(email *mail.Email) error {
-	server, err := e.server()
-	if err != nil {
-		return err
-	}
+// idEncoding is used for generated ids. Lowercase base32 is safe in headers and case-insensitive filesystems.
+var idEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
 
-	client, err := server.Connect()
-	if err != nil {
-		return err
+// randomID returns n random bytes encoded with idEncoding
+func randomID(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	defer client.Close()
-	return email.Send(client)
+	return idEncoding.EncodeToString(b), nil
+}
+
+// addressDomain returns the domain of an address
+func addressDomain(address string) string {
+	return address[strings.LastIndex(address, "@")+1:]
+}
+
+// Send sends the provided email using Email.Sender falling back on DefaultSender.
+func (e *Email) Send(email *mail.Email) error {
+	return e.SendForm(nil, email)
+}
+
+// SendForm sends the provided email using Email.Sender falling back on the form's sender, the config's sender and then DefaultSender.
+func (e *Email) SendForm(f *Form, email *mail.Email) error {
+	return sender(f, e).Send(e, email)
 }
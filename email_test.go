@@ -1,8 +1,11 @@
 package formailer
 
 import (
-	"os"
+	"strings"
 	"testing"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
 )
 
 type testGetTemplate struct {
@@ -30,10 +33,10 @@ func TestGetTemplate(t *testing.T) {
 }
 
 func TestSMTPSetup(t *testing.T) {
-	os.Setenv("SMTP_HOST", "mail.example.com")
-	os.Setenv("SMTP_PORT", "587")
-	os.Setenv("SMTP_CONTACT_USER", "username@example.com")
-	os.Setenv("SMTP_CONTACT_PASS", "mysupersecretpassword")
+	t.Setenv("SMTP_HOST", "mail.example.com")
+	t.Setenv("SMTP_PORT", "587")
+	t.Setenv("SMTP_CONTACT_USER", "username@example.com")
+	t.Setenv("SMTP_CONTACT_PASS", "mysupersecretpassword")
 
 	f := Email{ID: "Contact"}
 	_, err := f.server()
@@ -59,3 +62,170 @@ func TestGenerate(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestSubjectSpamTag(t *testing.T) {
+	form := &Form{CaptchaSpamTag: "[SPAM?]"}
+	email := Email{Subject: "New Contact Submission"}
+
+	submission := &Submission{Form: form}
+	if s, _ := email.subject(submission); s != "New Contact Submission" {
+		t.Errorf("Unexpected subject: %s", s)
+	}
+
+	submission.Spam = true
+	if s, _ := email.subject(submission); s != "[SPAM?] New Contact Submission" {
+		t.Errorf("Unexpected subject: %s", s)
+	}
+}
+
+func TestGenerateText(t *testing.T) {
+	submission := Submission{
+		Form:  testForm,
+		Order: []string{"Name", "Message"},
+		Values: map[string]interface{}{
+			"Name":       []string{"Rayne", "Atwood"},
+			"Message":    "Hello, <World>!",
+			"_form_name": "test",
+		},
+	}
+
+	email := Email{}
+	text, err := email.generateText(&submission)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "New test submission\n\nName\nRayne\nAtwood\n\nMessage\nHello, <World>!\n"
+	if text != expected {
+		t.Errorf("Unexpected text message\nExpected: %q\nGot: %q", expected, text)
+	}
+}
+
+func TestEmailAlternative(t *testing.T) {
+	submission := Submission{
+		Form:   testForm,
+		Order:  []string{"Message"},
+		Values: map[string]interface{}{"Message": "Hello, World!"},
+	}
+
+	email := Email{To: "info@example.com", From: "noreply@example.com"}
+	msg, err := email.Email(&submission)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := msg.GetMessage()
+	for _, part := range []string{"multipart/alternative", "text/plain", "text/html"} {
+		if !strings.Contains(message, part) {
+			t.Errorf("Expected message to contain %s", part)
+		}
+	}
+}
+
+func TestMessageHeaders(t *testing.T) {
+	form := &Form{ID: "thread", ThreadField: "email"}
+	email := Email{To: "info@example.com", From: `"Forms" <noreply@example.com>`}
+	headers := func(s *Submission) (string, string, string) {
+		t.Helper()
+		msg, err := email.Email(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := parseMessage(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.Headers["Message-Id"], m.Headers["X-Formailer-Submission-Id"], m.Headers["References"]
+	}
+
+	first := &Submission{ID: "abc123", Form: form, Values: map[string]interface{}{"email": []string{"Person@Example.com"}}}
+	id, submissionID, thread := headers(first)
+	if !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") || strings.Contains(id, "=") {
+		t.Errorf("Unexpected Message-Id \nExpected: <token@example.com>; Got: %s", id)
+	}
+	if submissionID != "abc123" {
+		t.Errorf("Unexpected X-Formailer-Submission-Id \nExpected: abc123; Got: %s", submissionID)
+	}
+	if !strings.HasPrefix(thread, "<thread.") || strings.Contains(thread, "person") {
+		t.Errorf("Unexpected References \nExpected: a hashed thread id; Got: %s", thread)
+	}
+
+	again, _, againThread := headers(&Submission{ID: "def456", Form: form, Values: map[string]interface{}{"email": " person@example.com"}})
+	if again == id || againThread != thread {
+		t.Errorf("Expected a new Message-Id in the same thread \nExpected: %s; Got: %s", thread, againThread)
+	}
+
+	_, _, other := headers(&Submission{Form: form, Values: map[string]interface{}{"email": "someone@example.com"}})
+	if other == thread {
+		t.Error("Expected a different thread for a different submitter")
+	}
+
+	_, missingID, none := headers(&Submission{Form: testForm})
+	if len(none) > 0 || len(missingID) > 0 {
+		t.Errorf("Expected no threading or submission id headers; Got: %q %q", none, missingID)
+	}
+}
+
+func TestSMTPModes(t *testing.T) {
+	t.Setenv("SMTP_HOST", "mail.example.com")
+	t.Setenv("SMTP_PORT", "587")
+	t.Setenv("SMTP_USER", "")
+	t.Setenv("SMTP_PASS", "")
+	t.Setenv("SMTP_RELAY_ENCRYPTION", "none")
+	t.Setenv("SMTP_RELAY_AUTH", "none")
+	t.Setenv("SMTP_RELAY_HELO", "forms.example.com")
+	t.Setenv("SMTP_SSL_PORT", "465")
+	t.Setenv("SMTP_SSL_USER", "user")
+	t.Setenv("SMTP_SSL_PASS", "pass")
+	t.Setenv("SMTP_SSL_ENCRYPTION", "SSL")
+	t.Setenv("SMTP_SSL_AUTH", "cram-md5")
+	t.Setenv("SMTP_SSL_CONNECT_TIMEOUT", "30")
+	t.Setenv("SMTP_SSL_SEND_TIMEOUT", "1m30s")
+	t.Setenv("SMTP_SSL_INSECURE_SKIP_VERIFY", "true")
+
+	relay, err := (&Email{ID: "relay"}).server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relay.Encryption != mail.EncryptionNone || relay.Authentication != mail.AuthNone || relay.Helo != "forms.example.com" {
+		t.Errorf("Unexpected relay settings: %+v", relay)
+	}
+	if relay.ConnectTimeout != 10*time.Second || relay.SendTimeout != 10*time.Minute || relay.TLSConfig != nil {
+		t.Errorf("Expected default timeouts and TLS config: %+v", relay)
+	}
+
+	ssl, err := (&Email{ID: "ssl"}).server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ssl.Port != 465 || ssl.Encryption != mail.EncryptionSSLTLS || ssl.Authentication != mail.AuthCRAMMD5 {
+		t.Errorf("Unexpected ssl settings: %+v", ssl)
+	}
+	if ssl.ConnectTimeout != 30*time.Second || ssl.SendTimeout != 90*time.Second || !ssl.TLSConfig.InsecureSkipVerify {
+		t.Errorf("Unexpected ssl timeouts or TLS config: %+v", ssl)
+	}
+
+	// tls kept the meaning of the original EncryptionTLS default
+	t.Setenv("SMTP_TLS_ENCRYPTION", "tls")
+	t.Setenv("SMTP_TLS_AUTH", "none")
+	if tls, err := (&Email{ID: "tls"}).server(); err != nil || tls.Encryption != mail.EncryptionSTARTTLS {
+		t.Errorf("Expected tls to use STARTTLS; Got: %v %v", tls, err)
+	}
+
+	if _, err := (&Email{ID: "default"}).server(); err == nil || !strings.Contains(err.Error(), "SMTP_DEFAULT_USER or SMTP_USER") {
+		t.Errorf("Expected missing user error when authenticating; Got: %v", err)
+	}
+
+	t.Setenv("SMTP_BAD_AUTH", "oauth")
+	t.Setenv("SMTP_BAD_USER", "user")
+	t.Setenv("SMTP_BAD_PASS", "pass")
+	if _, err := (&Email{ID: "bad"}).server(); err == nil || !strings.Contains(err.Error(), "invalid SMTP_BAD_AUTH") {
+		t.Errorf("Expected invalid auth error; Got: %v", err)
+	}
+
+	t.Setenv("SMTP_BAD_AUTH", "")
+	t.Setenv("SMTP_BAD_SEND_TIMEOUT", "forever")
+	if _, err := (&Email{ID: "bad"}).server(); err == nil || !strings.Contains(err.Error(), "could not parse SMTP_BAD_SEND_TIMEOUT") {
+		t.Errorf("Expected timeout parse error; Got: %v", err)
+	}
+}
@@ -3,13 +3,12 @@ package gcf
 import (
 	"github.com/torrayne/formailer"
 	"github.com/torrayne/formailer/handlers"
-	"net/http"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 )
 
-// Formailer handles all form submissions
-func Formailer(w http.ResponseWriter, r *http.Request) {
+// Google Cloud Function entry point defined as "main":
+func init() {
 	contact := formailer.New("Contact")
 	contact.AddEmail(formailer.Email{
 		ID:      "contact",
@@ -18,10 +17,5 @@ func Formailer(w http.ResponseWriter, r *http.Request) {
 		Subject: "New Contact Submission",
 	})
 
-	handlers.Vercel(formailer.DefaultConfig, w, r)
-}
-
-// Google Cloud Function entry point defined as "main":
-func init() {
-	functions.HTTP("main", Formailer)
+	functions.HTTP("main", handlers.New(formailer.DefaultConfig).ServeHTTP)
 }
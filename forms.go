@@ -1,8 +1,11 @@
 package formailer
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"mime"
 	"strings"
 )
@@ -22,13 +25,72 @@ type Form struct {
 	// Emails is a list of emails. Generally you want to use the AddEmail method instead of adding emails directly.
 	Emails []Email
 
+	// AutoReply sends a confirmation email to the submitter after the form's emails have been sent.
+	AutoReply *AutoReply
+
 	// Redirect is used when with the default handlers to return 303 See Other and points the browser to the set value.
 	Redirect string
 
 	// When ReCAPTCHA is set to true the default handlers with verify the g-recaptcha-response field.
+	// It is the same as setting Captcha to CaptchaReCAPTCHA.
 	ReCAPTCHA bool
 
+	// Captcha is the name of the captcha provider the default handlers use to verify submissions.
+	// Built-in providers are CaptchaReCAPTCHA, CaptchaHCaptcha and CaptchaTurnstile. Leave empty to disable verification.
+	Captcha string
+
+	// CaptchaMinScore rejects submissions scoring lower than this. Scores are only sent by reCAPTCHA v3 and hCaptcha Enterprise.
+	CaptchaMinScore float64
+
+	// CaptchaAction rejects submissions where the action doesn't match. Only used with reCAPTCHA v3.
+	CaptchaAction string
+
+	// CaptchaHostnames rejects submissions solved on any other site. When empty all hostnames are allowed.
+	CaptchaHostnames []string
+
+	// CaptchaSpamTag sends submissions failing the score, action or hostname checks with the tag prefixed to every subject instead of rejecting them.
+	CaptchaSpamTag string
+
+	// Honeypot is a list of hidden fields that people leave empty but bots fill in.
+	// When any of them has a value the built-in handlers fake a successful response without sending any emails.
+	// Honeypot fields are never included in Submission.Order.
+	Honeypot []string
+
+	// Rules maps field names to validation rules checked by Submission.Validate. Generally you want to use the AddRule method.
+	Rules map[string]Rule
+
+	// ThreadField is a submitted field, usually the submitter's email address, used to thread emails together.
+	// Every submission with the same value gets the same In-Reply-To and References headers.
+	ThreadField string
+
+	// Concurrency is how many of the form's emails are sent at once. Zero sends them one at a time.
+	Concurrency int
+
+	// AttachmentLimits restricts the size, number and type of uploaded files.
+	AttachmentLimits AttachmentLimits
+
+	// RateLimit limits how many submissions the built-in handlers accept per client IP and for the whole form.
+	RateLimit RateLimit
+
+	// Sender delivers the form's emails unless an Email sets its own. When nil the sender set with Config.SetSender is used, then DefaultSender.
+	Sender Sender
+
 	ignore map[string]bool
+
+	// configSender is the sender set with Config.SetSender on the config the form was added to
+	configSender Sender
+}
+
+// Built-in captcha provider names for Form.Captcha.
+const (
+	CaptchaReCAPTCHA = "recaptcha"
+	CaptchaHCaptcha  = "hcaptcha"
+	CaptchaTurnstile = "turnstile"
+)
+
+// captchaFields are the fields the built-in captcha providers submit their tokens in
+var captchaFields = []string{
+	"g-recaptcha-response", "h-captcha-response", "cf-turnstile-response",
 }
 
 // DefaultConfig is the config used when using functions New, Add, and Parse.
@@ -36,36 +98,108 @@ type Form struct {
 var DefaultConfig = make(Config)
 
 // New creates a new Form and adds it to the default config.
-// It also automatically sets the name to the ID and adds ignores the form name and recaptcha fields.
+// It also automatically sets the name to the ID and adds ignores the form name and captcha fields.
 func New(id string) *Form {
-	f := &Form{ID: id, ignore: make(map[string]bool)}
-	f.Ignore("_form_name", "g-recaptcha-response")
+	f := newForm(id)
 	Add(f)
 	return f
 }
 
+// newForm creates a form ignoring the form name and captcha fields
+func newForm(id string) *Form {
+	f := &Form{ID: id, ignore: make(map[string]bool)}
+	f.Ignore("_form_name")
+	f.Ignore(captchaFields...)
+	return f
+}
+
 // Add adds forms to the default config. It allows you to add forms without the default settings provided by New.
 func Add(forms ...*Form) {
 	DefaultConfig.Add(forms...)
 }
 
+// defaultMaxMemory is how many bytes of a submission ParseReader keeps in memory unless WithMaxMemory is passed
+const defaultMaxMemory = 32 << 20
+
+// ParseOption changes how a submission is parsed.
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	maxMemory int64
+}
+
+// WithMaxMemory keeps up to n bytes of the submission in memory instead of the default 32MB.
+// Uploaded files past it are written to temporary files and larger JSON or URL encoded bodies are rejected.
+func WithMaxMemory(n int64) ParseOption {
+	return func(o *parseOptions) {
+		o.maxMemory = n
+	}
+}
+
 // Parse creates a submission using the default config.
 func Parse(contentType, body string) (*Submission, error) {
 	return DefaultConfig.Parse(contentType, body)
 }
 
+// ParseBody creates a submission from a body that may be base64 encoded using the default config.
+func ParseBody(contentType, body string, isBase64 bool, opts ...ParseOption) (*Submission, error) {
+	return DefaultConfig.ParseBody(contentType, body, isBase64, opts...)
+}
+
+// ParseReader creates a submission from r using the default config.
+func ParseReader(ctx context.Context, contentType string, r io.Reader, opts ...ParseOption) (*Submission, error) {
+	return DefaultConfig.ParseReader(ctx, contentType, r, opts...)
+}
+
 // Add adds forms to the config falling back on Name if ID is not set.
+// The forms use the sender set with SetSender on the config.
 func (c Config) Add(forms ...*Form) {
+	var s Sender
+	for _, form := range c {
+		s = form.configSender
+		break
+	}
+
 	for _, form := range forms {
 		id := strings.ToLower(or(form.ID, form.Name))
 		c[id] = form
+		form.configSender = s
 	}
 }
 
-// Parse creates a submission parsing the data based on the Content-Type header.
-// Setting Submission.Form based on the _form_name field and removing any ignored fields from Submisson.Order.
+// Parse creates a submission from a body already in memory. It is a wrapper around ParseReader.
+// The body is used as is, use ParseBody for base64 encoded bodies.
 func (c Config) Parse(contentType string, body string) (*Submission, error) {
+	return c.ParseBody(contentType, body, false)
+}
+
+// ParseBody creates a submission from a body already in memory, decoding it first when isBase64 is true.
+// Serverless platforms like Netlify and AWS Lambda base64 encode some bodies and set a flag saying so, such as IsBase64Encoded.
+func (c Config) ParseBody(contentType, body string, isBase64 bool, opts ...ParseOption) (*Submission, error) {
+	var r io.Reader = strings.NewReader(body)
+	if isBase64 {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+	return c.ParseReader(context.Background(), contentType, r, opts...)
+}
+
+// ParseReader creates a submission parsing r based on the Content-Type header.
+// Setting Submission.Form based on the _form_name field and removing any ignored fields from Submisson.Order.
+// Multipart bodies are streamed, uploaded files that don't fit in memory, 32MB unless WithMaxMemory is passed, are written to temporary files which Submission.Cleanup removes.
+// Reading stops with the context's error once it is done.
+func (c Config) ParseReader(ctx context.Context, contentType string, r io.Reader, opts ...ParseOption) (*Submission, error) {
+	o := parseOptions{maxMemory: defaultMaxMemory}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	id, err := randomID(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate submission id: %w", err)
+	}
+
 	submission := new(Submission)
+	submission.ID = id
 	submission.Values = make(map[string]interface{})
 
 	contentType, params, err := mime.ParseMediaType(contentType)
@@ -73,34 +207,66 @@ func (c Config) Parse(contentType string, body string) (*Submission, error) {
 		return nil, fmt.Errorf("failed to parse content-type: %w", err)
 	}
 
+	r = contextReader{ctx: ctx, r: r}
+	var body string
 	switch contentType {
 	case "application/json":
-		err = submission.parseJSON(body)
+		if body, err = readBody(r, o.maxMemory); err == nil {
+			err = submission.parseJSON(body)
+		}
 	case "application/x-www-form-urlencoded":
-		err = submission.parseURLEncoded(body)
+		if body, err = readBody(r, o.maxMemory); err == nil {
+			err = submission.parseURLEncoded(body)
+		}
 	case "multipart/form-data":
-		err = submission.parseMultipartForm(params["boundary"], body)
+		err = submission.parseMultipartForm(params["boundary"], r, o.maxMemory, func() AttachmentLimits {
+			return c.attachmentLimits(submission.Values["_form_name"])
+		})
 	default:
 		err = errors.New("invalid content type")
 	}
 	if err != nil {
+		submission.Cleanup()
 		return nil, fmt.Errorf("failed to parse body: %w", err)
 	}
 
 	form, ok := submission.Values["_form_name"].(string)
 	if !ok || len(form) < 1 {
+		submission.Cleanup()
 		return nil, errors.New("missing _form_name field in submitted form data")
 	}
 
 	form = strings.ToLower(form)
 	submission.Form, ok = c[form]
 	if !ok {
+		submission.Cleanup()
 		return nil, fmt.Errorf("missing form config for form %s", form)
 	}
 
 	submission.removeIgnored()
+	submission.checkAttachments()
+
+	return submission, nil
+}
 
-	return submission, err
+// attachmentLimits returns the limits of the named form for enforcing while files are read.
+// Until the _form_name field has been read the form isn't known so the loosest limits of every form are used.
+func (c Config) attachmentLimits(name interface{}) AttachmentLimits {
+	if names := values(name); len(names) > 0 {
+		if form, ok := c[strings.ToLower(names[0])]; ok {
+			return form.AttachmentLimits
+		}
+	}
+
+	var limits AttachmentLimits
+	first := true
+	for _, form := range c {
+		if first {
+			limits, first = form.AttachmentLimits, false
+		}
+		limits = limits.looser(form.AttachmentLimits)
+	}
+	return limits
 }
 
 // AddEmail adds emails to the form.
@@ -108,8 +274,19 @@ func (f *Form) AddEmail(emails ...Email) {
 	f.Emails = append(f.Emails, emails...)
 }
 
+// CaptchaProvider returns the name of the captcha provider submissions should be verified with or an empty string.
+func (f *Form) CaptchaProvider() string {
+	if len(f.Captcha) < 1 && f.ReCAPTCHA {
+		return CaptchaReCAPTCHA
+	}
+	return f.Captcha
+}
+
 // Ignore updates the Form.ignore map
 func (f *Form) Ignore(fields ...string) {
+	if f.ignore == nil {
+		f.ignore = make(map[string]bool)
+	}
 	for _, field := range fields {
 		f.ignore[field] = true
 	}
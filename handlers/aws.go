@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/torrayne/formailer"
+)
+
+// APIGatewayV2 handles requests from AWS API Gateway HTTP APIs using payload format version 2.0.
+// The client IP is the address that connected to API Gateway unless WithTrustedProxies says otherwise.
+func APIGatewayV2(c formailer.Config, opts ...Option) func(events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
+	h := newHandler(c, opts...)
+	return func(request events.APIGatewayV2HTTPRequest) (*events.APIGatewayV2HTTPResponse, error) {
+		w := h.serveEvent(lambdaRequest{
+			method:   request.RequestContext.HTTP.Method,
+			sourceIP: request.RequestContext.HTTP.SourceIP,
+			header:   eventHeader(request.Headers, nil, request.Cookies),
+			body:     request.Body,
+			isBase64: request.IsBase64Encoded,
+		})
+
+		headers, cookies := w.headersV2()
+		return &events.APIGatewayV2HTTPResponse{
+			StatusCode: w.code,
+			Headers:    headers,
+			Cookies:    cookies,
+			Body:       w.body.String(),
+		}, nil
+	}
+}
+
+// FunctionURL handles requests from AWS Lambda function URLs.
+// The client IP is the address that connected to the function URL unless WithTrustedProxies says otherwise.
+func FunctionURL(c formailer.Config, opts ...Option) func(events.LambdaFunctionURLRequest) (*events.LambdaFunctionURLResponse, error) {
+	h := newHandler(c, opts...)
+	return func(request events.LambdaFunctionURLRequest) (*events.LambdaFunctionURLResponse, error) {
+		w := h.serveEvent(lambdaRequest{
+			method:   request.RequestContext.HTTP.Method,
+			sourceIP: request.RequestContext.HTTP.SourceIP,
+			header:   eventHeader(request.Headers, nil, request.Cookies),
+			body:     request.Body,
+			isBase64: request.IsBase64Encoded,
+		})
+
+		headers, cookies := w.headersV2()
+		return &events.LambdaFunctionURLResponse{
+			StatusCode: w.code,
+			Headers:    headers,
+			Cookies:    cookies,
+			Body:       w.body.String(),
+		}, nil
+	}
+}
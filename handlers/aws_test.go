@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/go-cmp/cmp"
+	"github.com/torrayne/formailer"
+)
+
+func TestAPIGatewayV2(t *testing.T) {
+	var sent int
+	c := testConfig(&sent)
+	c["contact"].RateLimit.PerIP = formailer.Limit{Requests: 1, Period: time.Minute}
+	handler := APIGatewayV2(c)
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	w.WriteField("_form_name", "contact")
+	w.WriteField("email", "a@example.com")
+	file, _ := w.CreateFormFile("file", "cv.pdf")
+	file.Write([]byte("%PDF-1.4"))
+	w.Close()
+
+	request := events.APIGatewayV2HTTPRequest{
+		Headers:         map[string]string{"content-type": w.FormDataContentType(), "x-forwarded-for": "198.51.100.1"},
+		Cookies:         []string{"session=abc"},
+		Body:            base64.StdEncoding.EncodeToString(body.Bytes()),
+		IsBase64Encoded: true,
+	}
+	request.RequestContext.HTTP.Method = http.MethodPost
+	request.RequestContext.HTTP.SourceIP = "192.0.2.1"
+
+	response, err := handler(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || response.Headers["Content-Type"] != "application/json" {
+		t.Errorf("Unexpected response %d %v %s", response.StatusCode, response.Headers, response.Body)
+	}
+
+	// X-Forwarded-For isn't trusted so the same source address is limited
+	request.Headers["x-forwarded-for"] = "198.51.100.2"
+	response, err = handler(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusTooManyRequests || response.Headers["Retry-After"] != "60" {
+		t.Errorf("Expected the source ip to be rate limited; Got: %d %v", response.StatusCode, response.Headers)
+	}
+	if sent != 1 {
+		t.Errorf("Unexpected number of emails sent \nExpected: 1; Got: %d", sent)
+	}
+}
+
+func TestFunctionURL(t *testing.T) {
+	var sent int
+	c := testConfig(&sent)
+	c["contact"].Redirect = "/thanks"
+	handler := FunctionURL(c)
+
+	request := events.LambdaFunctionURLRequest{
+		Headers: map[string]string{"content-type": "application/json"},
+		Body:    `{"_form_name":"contact","email":"a@example.com"}`,
+	}
+	request.RequestContext.HTTP.Method = http.MethodPost
+
+	response, err := handler(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSeeOther || response.Headers["Location"] != "/thanks" {
+		t.Errorf("Expected redirect to /thanks; Got: %d %v", response.StatusCode, response.Headers)
+	}
+
+	request.RequestContext.HTTP.Method = http.MethodGet
+	response, err = handler(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status \nExpected: %d; Got: %d", http.StatusMethodNotAllowed, response.StatusCode)
+	}
+	if sent != 1 {
+		t.Errorf("Unexpected number of emails sent \nExpected: 1; Got: %d", sent)
+	}
+}
+
+func TestEventHeader(t *testing.T) {
+	header := eventHeader(
+		map[string]string{"content-type": "application/json", "x-forwarded-for": "192.0.2.1, 10.0.0.1"},
+		map[string][]string{"X-Forwarded-For": {"192.0.2.1", "10.0.0.1"}},
+		[]string{"a=1", "b=2"},
+	)
+	expected := http.Header{
+		"Content-Type":    {"application/json"},
+		"X-Forwarded-For": {"192.0.2.1", "10.0.0.1"},
+		"Cookie":          {"a=1; b=2"},
+	}
+	if diff := cmp.Diff(expected, header); len(diff) > 0 {
+		t.Errorf("Unexpected header (-want +got):\n%s", diff)
+	}
+}
+
+func TestLambdaResponseHeaders(t *testing.T) {
+	w := &lambdaResponseWriter{header: make(http.Header), code: http.StatusOK}
+	w.Header().Add("Vary", "Origin")
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Set-Cookie", "a=1")
+	w.Header().Add("Set-Cookie", "b=2")
+
+	headers, cookies := w.headersV2()
+	if headers["Vary"] != "Origin,Accept" || strings.Join(cookies, " ") != "a=1 b=2" || len(headers["Set-Cookie"]) > 0 {
+		t.Errorf("Unexpected v2 headers %v %v", headers, cookies)
+	}
+
+	response := w.response()
+	if response.Headers["Vary"] != "Origin" || len(response.MultiValueHeaders["Vary"]) != 2 || len(response.MultiValueHeaders["Set-Cookie"]) != 2 {
+		t.Errorf("Unexpected v1 headers %v %v", response.Headers, response.MultiValueHeaders)
+	}
+}
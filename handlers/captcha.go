@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/torrayne/formailer"
+)
+
+var errCaptchaBadRequest = errors.New("invalid or malformed captcha")
+
+// Captcha verifies tokens using a provider's siteverify endpoint.
+// reCAPTCHA, hCaptcha and Turnstile all share the same request and response format.
+type Captcha struct {
+	// Name is used in error messages.
+	Name string
+
+	// Field is the form field the widget stores its token in.
+	Field string
+
+	// SecretEnv is the environment variable holding the secret key.
+	SecretEnv string
+
+	// VerifyURL is the siteverify endpoint. Override it to test against a local server.
+	VerifyURL string
+
+	// Client is used to make verify requests, when nil captchaClient is used.
+	Client *http.Client
+}
+
+// captchaClient gives up on a provider that doesn't respond so the function isn't left hanging until the platform kills it
+var captchaClient = &http.Client{Timeout: 10 * time.Second}
+
+// CaptchaResult is the decoded siteverify response.
+type CaptchaResult struct {
+	Success    bool
+	ErrorCodes []string `json:"error-codes"`
+
+	// Score and Action are only sent by reCAPTCHA v3, hCaptcha Enterprise sends Score.
+	Score  float64
+	Action string
+
+	Hostname    string
+	ChallengeTS string `json:"challenge_ts"`
+}
+
+// Check compares the result to the form's score, action and hostname settings.
+func (r *CaptchaResult) Check(form *formailer.Form) error {
+	if form.CaptchaMinScore > 0 && r.Score < form.CaptchaMinScore {
+		return fmt.Errorf("captcha score %g is below %g", r.Score, form.CaptchaMinScore)
+	}
+	if len(form.CaptchaAction) > 0 && r.Action != form.CaptchaAction {
+		return fmt.Errorf("captcha action %q does not match %q", r.Action, form.CaptchaAction)
+	}
+	if len(form.CaptchaHostnames) > 0 {
+		for _, hostname := range form.CaptchaHostnames {
+			if strings.EqualFold(r.Hostname, hostname) {
+				return nil
+			}
+		}
+		return fmt.Errorf("captcha hostname %q is not allowed", r.Hostname)
+	}
+	return nil
+}
+
+// The built-in captcha providers. Their VerifyURL can be changed to point to a local server for testing.
+var (
+	// ReCAPTCHA verifies Google reCAPTCHA v2 and v3 tokens.
+	ReCAPTCHA = &Captcha{
+		Name:      "reCAPTCHA",
+		Field:     "g-recaptcha-response",
+		SecretEnv: "RECAPTCHA_SECRET",
+		VerifyURL: "https://www.google.com/recaptcha/api/siteverify",
+	}
+
+	// HCaptcha verifies hCaptcha tokens.
+	HCaptcha = &Captcha{
+		Name:      "hCaptcha",
+		Field:     "h-captcha-response",
+		SecretEnv: "HCAPTCHA_SECRET",
+		VerifyURL: "https://api.hcaptcha.com/siteverify",
+	}
+
+	// Turnstile verifies Cloudflare Turnstile tokens.
+	Turnstile = &Captcha{
+		Name:      "Turnstile",
+		Field:     "cf-turnstile-response",
+		SecretEnv: "TURNSTILE_SECRET",
+		VerifyURL: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	}
+)
+
+// Captchas maps the names used in Form.Captcha to providers. Add to it to register your own provider.
+var Captchas = map[string]*Captcha{
+	formailer.CaptchaReCAPTCHA: ReCAPTCHA,
+	formailer.CaptchaHCaptcha:  HCaptcha,
+	formailer.CaptchaTurnstile: Turnstile,
+}
+
+// Verify posts the token to the provider's siteverify endpoint.
+// Expired or duplicate tokens are reported as unsuccessful, any other error code returns an error.
+func (c *Captcha) Verify(token string) (*CaptchaResult, error) {
+	client := c.Client
+	if client == nil {
+		client = captchaClient
+	}
+
+	data := url.Values{}
+	data.Set("secret", os.Getenv(c.SecretEnv))
+	data.Set("response", token)
+	resp, err := client.PostForm(c.VerifyURL, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s responded with %s", c.Name, resp.Status)
+	}
+
+	result := new(CaptchaResult)
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", c.Name, err)
+	}
+
+	for _, code := range result.ErrorCodes {
+		if code != "timeout-or-duplicate" {
+			return result, errCaptchaBadRequest
+		}
+	}
+
+	return result, nil
+}
+
+// VerifyRecaptcha verifies the recaptcha response
+func VerifyRecaptcha(response string) (bool, error) {
+	result, err := ReCAPTCHA.Verify(response)
+	if result == nil {
+		return false, err
+	}
+	return result.Success, err
+}
+
+// verifyCaptcha checks the submission's captcha token.
+// It returns the status code to respond with when verification fails, or 0 on success.
+func (h *Handler) verifyCaptcha(captcha *Captcha, submission *formailer.Submission) (int, error) {
+	token, _ := submission.Values[captcha.Field].(string)
+	if len(token) < 1 {
+		return http.StatusBadRequest, fmt.Errorf("missing %s response", captcha.Name)
+	}
+
+	result, err := captcha.Verify(token)
+	if errors.Is(err, errCaptchaBadRequest) {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to verify %s: %w", captcha.Name, err)
+	}
+	if !result.Success {
+		return http.StatusBadRequest, fmt.Errorf("failed %s verification", captcha.Name)
+	}
+
+	if err := result.Check(submission.Form); err != nil {
+		if len(submission.Form.CaptchaSpamTag) < 1 {
+			return http.StatusBadRequest, err
+		}
+		h.logger.Infof("tagged %s form submission as spam: %v", submission.Values["_form_name"], err)
+		submission.Spam = true
+	}
+
+	delete(submission.Values, captcha.Field)
+	return 0, nil
+}
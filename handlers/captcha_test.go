@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/torrayne/formailer"
+)
+
+// testCaptchaServer responds to siteverify requests, tokens are looked up in responses
+func testCaptchaServer(t *testing.T, secret string, responses map[string]CaptchaResult) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("secret") != secret {
+			json.NewEncoder(w).Encode(CaptchaResult{ErrorCodes: []string{"invalid-input-secret"}})
+			return
+		}
+
+		result, ok := responses[r.PostFormValue("response")]
+		if !ok {
+			result = CaptchaResult{ErrorCodes: []string{"invalid-input-response"}}
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+}
+
+func TestVerifyRecaptcha(t *testing.T) {
+	server := testCaptchaServer(t, "", nil)
+	defer server.Close()
+
+	verifyURL := ReCAPTCHA.VerifyURL
+	ReCAPTCHA.VerifyURL = server.URL
+	defer func() { ReCAPTCHA.VerifyURL = verifyURL }()
+
+	_, err := VerifyRecaptcha("")
+	if err != nil && err != errCaptchaBadRequest {
+		t.Error(err)
+	}
+}
+
+func TestCaptchaVerify(t *testing.T) {
+	for _, captcha := range []*Captcha{ReCAPTCHA, HCaptcha, Turnstile} {
+		t.Setenv(captcha.SecretEnv, "secret-"+captcha.Name)
+		server := testCaptchaServer(t, "secret-"+captcha.Name, map[string]CaptchaResult{
+			"human":   {Success: true},
+			"expired": {ErrorCodes: []string{"timeout-or-duplicate"}},
+		})
+
+		c := *captcha
+		c.VerifyURL = server.URL
+
+		result, err := c.Verify("human")
+		if err != nil || !result.Success {
+			t.Errorf("%s: expected successful verification; Got: %v %v", c.Name, result, err)
+		}
+
+		result, err = c.Verify("expired")
+		if err != nil || result.Success {
+			t.Errorf("%s: expected unsuccessful verification without error; Got: %v %v", c.Name, result, err)
+		}
+
+		_, err = c.Verify("forged")
+		if err != errCaptchaBadRequest {
+			t.Errorf("%s: expected bad request error; Got: %v", c.Name, err)
+		}
+
+		server.Close()
+	}
+}
+
+func TestCaptchaVerifyStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>Bad Gateway</html>", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	c := *HCaptcha
+	c.VerifyURL = server.URL
+	_, err := c.Verify("human")
+	if err == nil || err.Error() != "hCaptcha responded with 502 Bad Gateway" {
+		t.Errorf("Expected an error for the status code; Got: %v", err)
+	}
+}
+
+func TestVerifyCaptchaSubmission(t *testing.T) {
+	t.Setenv(Turnstile.SecretEnv, "turnstile")
+	server := testCaptchaServer(t, "turnstile", map[string]CaptchaResult{"human": {Success: true}})
+	defer server.Close()
+
+	verifyURL := Turnstile.VerifyURL
+	Turnstile.VerifyURL = server.URL
+	defer func() { Turnstile.VerifyURL = verifyURL }()
+
+	form := &formailer.Form{ID: "captcha", Captcha: formailer.CaptchaTurnstile}
+	tests := map[string]int{
+		"":      http.StatusBadRequest,
+		"bot":   http.StatusBadRequest,
+		"human": 0,
+	}
+
+	for token, expected := range tests {
+		submission := &formailer.Submission{
+			Form:   form,
+			Values: map[string]interface{}{"cf-turnstile-response": token},
+		}
+
+		code, err := newHandler(nil).verifyCaptcha(Turnstile, submission)
+		if code != expected {
+			t.Errorf("Unexpected status for token %q\nExpected: %d; Got: %d %v", token, expected, code, err)
+		}
+		if _, exists := submission.Values["cf-turnstile-response"]; code == 0 && exists {
+			t.Error("Expected verified token to be removed from values")
+		}
+	}
+}
+
+func TestCaptchaResultCheck(t *testing.T) {
+	form := &formailer.Form{
+		CaptchaMinScore:  0.5,
+		CaptchaAction:    "contact",
+		CaptchaHostnames: []string{"example.com"},
+	}
+
+	tests := map[string]struct {
+		result CaptchaResult
+		valid  bool
+	}{
+		"human":    {CaptchaResult{Score: 0.9, Action: "contact", Hostname: "Example.com"}, true},
+		"score":    {CaptchaResult{Score: 0.1, Action: "contact", Hostname: "example.com"}, false},
+		"action":   {CaptchaResult{Score: 0.9, Action: "login", Hostname: "example.com"}, false},
+		"hostname": {CaptchaResult{Score: 0.9, Action: "contact", Hostname: "evil.example"}, false},
+	}
+
+	for name, test := range tests {
+		err := test.result.Check(form)
+		if (err == nil) != test.valid {
+			t.Errorf("Unexpected result from CaptchaResult.Check on %s\nExpected valid: %t; Got: %v", name, test.valid, err)
+		}
+	}
+
+	result := CaptchaResult{Score: 0.45, Action: "contact", Hostname: "example.com"}
+	if err := result.Check(form); err == nil || err.Error() != "captcha score 0.45 is below 0.5" {
+		t.Errorf("Unexpected score error \nExpected: captcha score 0.45 is below 0.5; Got: %v", err)
+	}
+}
+
+func TestVerifyCaptchaSpamTag(t *testing.T) {
+	server := testCaptchaServer(t, "", map[string]CaptchaResult{
+		"bot": {Success: true, Score: 0.1, Action: "contact"},
+	})
+	defer server.Close()
+
+	t.Setenv(ReCAPTCHA.SecretEnv, "")
+	verifyURL := ReCAPTCHA.VerifyURL
+	ReCAPTCHA.VerifyURL = server.URL
+	defer func() { ReCAPTCHA.VerifyURL = verifyURL }()
+
+	form := &formailer.Form{ID: "captcha", ReCAPTCHA: true, CaptchaMinScore: 0.5}
+	submission := &formailer.Submission{Form: form, Values: map[string]interface{}{"g-recaptcha-response": "bot"}}
+	h := newHandler(nil)
+	if code, _ := h.verifyCaptcha(ReCAPTCHA, submission); code != http.StatusBadRequest {
+		t.Errorf("Expected low score to be rejected; Got: %d", code)
+	}
+
+	form.CaptchaSpamTag = "[SPAM?]"
+	submission.Values["g-recaptcha-response"] = "bot"
+	code, err := h.verifyCaptcha(ReCAPTCHA, submission)
+	if code != 0 || err != nil {
+		t.Errorf("Expected low score to be accepted with spam tag; Got: %d %v", code, err)
+	}
+	if !submission.Spam {
+		t.Error("Expected submission to be marked as spam")
+	}
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/torrayne/formailer"
+	"github.com/torrayne/formailer/logger"
+)
+
+// Logger is used by the handlers to log sent emails and errors.
+type Logger interface {
+	Infof(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// defaultLogger logs using the logger package
+type defaultLogger struct{}
+
+func (defaultLogger) Infof(format string, v ...interface{})  { logger.Infof(format, v...) }
+func (defaultLogger) Errorf(format string, v ...interface{}) { logger.Errorf(format, v...) }
+
+// Handler parses submissions, verifies them, and sends the form's emails.
+// It is shared by every built-in handler so they all behave the same.
+type Handler struct {
+	config      formailer.Config
+	captcha     *Captcha
+	format      Format
+	maxBodySize int64
+	maxMemory   int64
+	logger      Logger
+	store       formailer.Store
+	storeMode   StoreMode
+
+	limiter        RateLimiter
+	globalLimit    formailer.Limit
+	trustedProxies []*net.IPNet
+	unknownIP      *sync.Once
+}
+
+// StoreMode selects which submissions are saved by WithStore.
+type StoreMode int
+
+// Store modes for WithStore.
+const (
+	// StoreFailed saves submissions when any email fails to send.
+	StoreFailed StoreMode = iota
+
+	// StoreAll saves every submission that passes validation, marking them as sent or failed.
+	StoreAll
+)
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithCaptcha verifies every submission with c, overriding the provider set on the form.
+func WithCaptcha(c *Captcha) Option {
+	return func(h *Handler) {
+		h.captcha = c
+	}
+}
+
+// WithFormat sets how responses are written, JSON is used by default.
+func WithFormat(f Format) Option {
+	return func(h *Handler) {
+		h.format = f
+	}
+}
+
+// WithMaxBodySize rejects request bodies larger than n bytes with 413 Request Entity Too Large.
+// By default there is no limit.
+func WithMaxBodySize(n int64) Option {
+	return func(h *Handler) {
+		h.maxBodySize = n
+	}
+}
+
+// WithMaxMemory keeps up to n bytes of each submission in memory, larger uploads are written to temporary files.
+// By default 32MB is kept, see formailer.WithMaxMemory.
+func WithMaxMemory(n int64) Option {
+	return func(h *Handler) {
+		h.maxMemory = n
+	}
+}
+
+// WithStore saves submissions to store after sending so failed ones can be resent with formailer.Replay.
+// Submissions rejected by validation, the captcha, or a honeypot are never saved.
+func WithStore(store formailer.Store, mode StoreMode) Option {
+	return func(h *Handler) {
+		h.store = store
+		h.storeMode = mode
+	}
+}
+
+// WithRateLimiter stores rate limit counters in l instead of memory. Limits are set per form with Form.RateLimit and for every form with WithGlobalRateLimit.
+func WithRateLimiter(l RateLimiter) Option {
+	return func(h *Handler) {
+		h.limiter = l
+	}
+}
+
+// WithGlobalRateLimit limits the submissions accepted across every form.
+func WithGlobalRateLimit(limit formailer.Limit) Option {
+	return func(h *Handler) {
+		h.globalLimit = limit
+	}
+}
+
+// WithTrustedProxies reads the client IP from the X-Forwarded-For header for requests from these IP addresses or CIDR ranges.
+// Otherwise the connecting address is used so clients can't dodge per IP limits by sending the header themselves.
+// The Netlify handler always uses the X-Nf-Client-Connection-Ip header set by Netlify's edge. It panics if a proxy isn't a valid IP address or CIDR range.
+func WithTrustedProxies(proxies ...string) Option {
+	networks, err := parseProxies(proxies)
+	if err != nil {
+		panic("handlers: " + err.Error())
+	}
+	return func(h *Handler) {
+		h.trustedProxies = networks
+	}
+}
+
+// WithLogger sets the logger, by default the logger package is used.
+func WithLogger(l Logger) Option {
+	return func(h *Handler) {
+		h.logger = l
+	}
+}
+
+// New creates a http.Handler for the config. It can be mounted on any router.
+func New(c formailer.Config, opts ...Option) http.Handler {
+	return newHandler(c, opts...)
+}
+
+func newHandler(c formailer.Config, opts ...Option) *Handler {
+	h := &Handler{
+		config:    c,
+		format:    JSON,
+		logger:    defaultLogger{},
+		limiter:   NewMemoryLimiter(),
+		unknownIP: new(sync.Once),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// ServeHTTP handles a form submission. The body is streamed so large uploads are never held in memory as a whole.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if h.maxBodySize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+	}
+
+	ip := h.clientIP(r.RemoteAddr, "", r.Header)
+	code, location, err := h.handle(r.Method, ip, func() (*formailer.Submission, error) {
+		return h.config.ParseReader(r.Context(), r.Header.Get("Content-Type"), body, h.parseOptions()...)
+	})
+	h.respond(w, code, location, err)
+}
+
+// respond logs errors and writes the response using the handler's format
+func (h *Handler) respond(w http.ResponseWriter, code int, location string, err error) {
+	r := Response{Ok: err == nil}
+	if err != nil {
+		r.fail(err)
+		h.logger.Errorf("%v", err)
+
+		var limited *RateLimitError
+		if errors.As(err, &limited) {
+			w.Header().Set("Retry-After", strconv.Itoa(retrySeconds(limited.RetryAfter)))
+		}
+	}
+	if len(location) > 0 {
+		w.Header().Set("Location", location)
+	}
+
+	h.format(w, code, r)
+}
+
+// handle processes a submission from the client ip returning the status code, the location to redirect to, and any error.
+// The location is set on success and when only some emails failed.
+// parse reads the submission from the request, a *http.MaxBytesError means the body was over the size limit.
+func (h *Handler) handle(method, ip string, parse func() (*formailer.Submission, error)) (int, string, error) {
+	if method != http.MethodPost {
+		return http.StatusMethodNotAllowed, "", errors.New("method not allowed")
+	}
+
+	submission, err := parse()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge, "", fmt.Errorf("request body is larger than %d bytes", tooLarge.Limit)
+	}
+	if err != nil {
+		return http.StatusBadRequest, "", err
+	}
+	defer submission.Cleanup()
+
+	if err := h.rateLimit(submission.Form, ip); err != nil {
+		return http.StatusTooManyRequests, "", err
+	}
+
+	code, location := http.StatusOK, ""
+	if len(submission.Form.Redirect) > 0 {
+		code, location = http.StatusSeeOther, submission.Form.Redirect
+	}
+
+	if submission.HoneypotFilled() {
+		h.logger.Infof("ignored %s form submission with a filled honeypot field", submission.Values["_form_name"])
+		return code, location, nil
+	}
+
+	err = submission.Validate()
+	if err != nil {
+		return http.StatusBadRequest, "", err
+	}
+
+	captcha, err := h.captchaFor(submission.Form)
+	if err != nil {
+		return http.StatusInternalServerError, "", err
+	}
+	if captcha != nil {
+		if code, err := h.verifyCaptcha(captcha, submission); err != nil {
+			return code, "", err
+		}
+	}
+
+	results, err := submission.Deliver()
+	h.save(submission, err)
+
+	var failed *formailer.SendError
+	if errors.As(err, &failed) && len(failed.Delivered()) > 0 {
+		// The submission reached someone so the client is still pointed at the redirect
+		return http.StatusMultiStatus, location, fmt.Errorf("failed to send email: %w", err)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, "", fmt.Errorf("failed to send email: %w", err)
+	}
+
+	var names []string
+	for _, r := range results {
+		if !r.AutoReply {
+			names = append(names, or(r.ID, r.To))
+		}
+	}
+	h.logger.Infof("sent %d of %d emails [%s] from %s form submission %s", len(names), len(submission.Form.Emails), strings.Join(names, ", "), submission.Values["_form_name"], submission.ID)
+	return code, location, nil
+}
+
+// parseOptions returns the options submissions are parsed with
+func (h *Handler) parseOptions() []formailer.ParseOption {
+	if h.maxMemory > 0 {
+		return []formailer.ParseOption{formailer.WithMaxMemory(h.maxMemory)}
+	}
+	return nil
+}
+
+// captchaFor returns the captcha provider the form's submissions are verified with or nil.
+func (h *Handler) captchaFor(form *formailer.Form) (*Captcha, error) {
+	if h.captcha != nil {
+		return h.captcha, nil
+	}
+
+	name := form.CaptchaProvider()
+	if len(name) < 1 {
+		return nil, nil
+	}
+
+	captcha, ok := Captchas[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown captcha provider %s", name)
+	}
+	return captcha, nil
+}
+
+// save stores the submission when a store is set, logging any error so the response isn't affected
+func (h *Handler) save(submission *formailer.Submission, err error) {
+	if h.store == nil || (err == nil && h.storeMode != StoreAll) {
+		return
+	}
+
+	record, serr := formailer.NewRecord(submission, err)
+	if serr == nil {
+		serr = h.store.Save(record)
+	}
+	if serr != nil {
+		h.logger.Errorf("failed to store %s form submission %s: %v", submission.Values["_form_name"], submission.ID, serr)
+	}
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/torrayne/formailer"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// testConfig returns a config with a single contact form which counts sent emails
+func testConfig(sent *int) formailer.Config {
+	c := make(formailer.Config)
+	form := &formailer.Form{
+		ID:       "contact",
+		Honeypot: []string{"website"},
+		Sender: formailer.SenderFunc(func(*formailer.Email, *mail.Email) error {
+			*sent++
+			return nil
+		}),
+	}
+	form.AddEmail(formailer.Email{To: "info@example.com", From: "noreply@example.com"})
+	form.AddRule("email", formailer.Rule{Required: true, Email: true})
+	c.Add(form)
+	return c
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		method string
+		body   string
+		code   int
+		sent   int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed, 0},
+		{http.MethodPost, "_form_name=unknown", http.StatusBadRequest, 0},
+		{http.MethodPost, "_form_name=contact&email=invalid", http.StatusBadRequest, 0},
+		{http.MethodPost, "_form_name=contact&email=a@example.com&website=spam", http.StatusOK, 0},
+		{http.MethodPost, "_form_name=contact&email=a@example.com", http.StatusOK, 1},
+		{http.MethodPost, "_form_name=contact&email=a@example.com&message=" + strings.Repeat("a", 100), http.StatusRequestEntityTooLarge, 0},
+	}
+
+	for _, test := range tests {
+		var sent int
+		h := New(testConfig(&sent), WithMaxBodySize(64))
+
+		r := httptest.NewRequest(test.method, "/", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.code {
+			t.Errorf("Unexpected status for %s %s\nExpected: %d; Got: %d %s", test.method, test.body, test.code, w.Code, w.Body)
+		}
+		if sent != test.sent {
+			t.Errorf("Unexpected number of emails sent for %s\nExpected: %d; Got: %d", test.body, test.sent, sent)
+		}
+
+		var response Response
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Error(err)
+		}
+		if response.Ok != (test.code < 400) {
+			t.Errorf("Unexpected response for %s: %+v", test.body, response)
+		}
+	}
+}
+
+// testLogger keeps every message logged
+type testLogger struct {
+	messages []string
+}
+
+func (l *testLogger) Infof(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+func (l *testLogger) Errorf(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+func TestHandlerLogsSent(t *testing.T) {
+	var sent int
+	c := testConfig(&sent)
+	c["contact"].AddEmail(formailer.Email{ID: "sales", To: "sales@example.com", From: "noreply@example.com", Condition: &formailer.Condition{Field: "department", Value: "sales"}})
+	l := new(testLogger)
+	h := New(c, WithLogger(l))
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("_form_name=contact&email=a@example.com&department=support"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(l.messages) != 1 || !strings.HasPrefix(l.messages[0], "sent 1 of 2 emails [info@example.com] from contact form submission") {
+		t.Errorf("Unexpected log messages: %q", l.messages)
+	}
+}
+
+func TestHandlerValidationResponse(t *testing.T) {
+	var sent int
+	h := New(testConfig(&sent), WithFormat(Text))
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("_form_name=contact"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if !strings.Contains(w.Body.String(), "email: is required") {
+		t.Errorf("Expected invalid field in response; Got: %s", w.Body)
+	}
+}
+
+func TestHandlerPartialFailure(t *testing.T) {
+	c := make(formailer.Config)
+	form := &formailer.Form{ID: "contact", Redirect: "/thanks", Sender: formailer.SenderFunc(func(e *formailer.Email, _ *mail.Email) error {
+		if e.ID == "support" {
+			return errors.New("535 authentication failed for smtp.internal.example.com")
+		}
+		return nil
+	})}
+	form.AddEmail(
+		formailer.Email{ID: "sales", To: "sales@example.com", From: "noreply@example.com"},
+		formailer.Email{ID: "support", To: "support@example.com", From: "noreply@example.com"},
+	)
+	c.Add(form)
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("_form_name=contact"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	New(c).ServeHTTP(w, r)
+
+	if w.Code != http.StatusMultiStatus || w.Header().Get("Location") != "/thanks" {
+		t.Errorf("Unexpected status \nExpected: %d to /thanks; Got: %d %q", http.StatusMultiStatus, w.Code, w.Header().Get("Location"))
+	}
+	if strings.Contains(w.Body.String(), "smtp.internal.example.com") {
+		t.Errorf("Expected the send error to be left out of the response; Got: %s", w.Body)
+	}
+
+	var response Response
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Delivery{{ID: "sales", Ok: true}, {ID: "support"}}
+	if response.Ok || response.Error != "failed to send 1 of 2 emails" || len(response.Deliveries) != 2 || response.Deliveries[0] != expected[0] || response.Deliveries[1] != expected[1] {
+		t.Errorf("Unexpected deliveries \nExpected: %+v; Got: %+v", expected, response.Deliveries)
+	}
+}
+
+func TestNetlifyRedirect(t *testing.T) {
+	var sent int
+	c := testConfig(&sent)
+	c["contact"].Redirect = "/thanks"
+
+	response, err := Netlify(c)(events.APIGatewayProxyRequest{
+		HTTPMethod: http.MethodPost,
+		Headers:    map[string]string{"content-type": "application/x-www-form-urlencoded"},
+		Body:       "_form_name=contact&email=a@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSeeOther || response.Headers["Location"] != "/thanks" {
+		t.Errorf("Expected redirect to /thanks; Got: %d %v", response.StatusCode, response.Headers)
+	}
+	if sent != 1 {
+		t.Errorf("Expected 1 email to be sent; Got: %d", sent)
+	}
+}
+
+func TestHandlerStore(t *testing.T) {
+	down := false
+	c := make(formailer.Config)
+	form := &formailer.Form{ID: "contact", Sender: formailer.SenderFunc(func(*formailer.Email, *mail.Email) error {
+		if down {
+			return errors.New("connection refused")
+		}
+		return nil
+	})}
+	form.AddEmail(formailer.Email{To: "info@example.com", From: "noreply@example.com"})
+	c.Add(form)
+
+	send := func(h http.Handler, body string) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	for _, mode := range []StoreMode{StoreFailed, StoreAll} {
+		store := formailer.NewFileStore(filepath.Join(t.TempDir(), "submissions.jsonl"))
+		h := New(c, WithStore(store, mode))
+
+		down = false
+		send(h, "_form_name=contact&email=sent@example.com")
+		down = true
+		send(h, "_form_name=contact&email=failed@example.com")
+
+		failed, err := store.List(formailer.StatusFailed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(failed) != 1 || failed[0].Form != "contact" || failed[0].Error != "1 of 1 emails failed: info@example.com: connection refused" {
+			t.Errorf("Unexpected failed records for mode %d: %+v", mode, failed)
+		}
+
+		sent, err := store.List(formailer.StatusSent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := int(mode); len(sent) != expected {
+			t.Errorf("Unexpected number of sent records for mode %d \nExpected: %d; Got: %d", mode, expected, len(sent))
+		}
+	}
+}
+
+func TestHandlerLargeUpload(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	var sent int
+	h := New(testConfig(&sent), WithMaxMemory(1<<10))
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	w.WriteField("_form_name", "contact")
+	w.WriteField("email", "a@example.com")
+	file, _ := w.CreateFormFile("file", "large.bin")
+	file.Write(bytes.Repeat([]byte{1}, 4<<10))
+	w.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/", body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, r)
+
+	if recorder.Code != http.StatusOK || sent != 1 {
+		t.Errorf("Expected the upload to be sent; Got: %d %s", recorder.Code, recorder.Body)
+	}
+	if files, _ := os.ReadDir(tmp); len(files) > 0 {
+		t.Errorf("Expected temporary files to be removed; Got: %v", files)
+	}
+}
+
+func TestNetlifyBase64(t *testing.T) {
+	var sent int
+	handler := Netlify(testConfig(&sent), WithMaxBodySize(64))
+
+	bodies := map[string]string{
+		"application/json":                  `{"_form_name":"contact","email":"a@example.com"}`,
+		"application/x-www-form-urlencoded": "_form_name=contact&email=a@example.com",
+	}
+	for contentType, body := range bodies {
+		response, err := handler(events.APIGatewayProxyRequest{
+			HTTPMethod:      http.MethodPost,
+			Headers:         map[string]string{"content-type": contentType},
+			Body:            base64.StdEncoding.EncodeToString([]byte(body)),
+			IsBase64Encoded: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != http.StatusOK {
+			t.Errorf("Unexpected status for base64 %s body \nExpected: %d; Got: %d %s", contentType, http.StatusOK, response.StatusCode, response.Body)
+		}
+	}
+	if sent != 2 {
+		t.Errorf("Unexpected number of emails sent \nExpected: 2; Got: %d", sent)
+	}
+}
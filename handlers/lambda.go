@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/torrayne/formailer"
+)
+
+// lambdaResponseWriter collects a response so it can be returned to aws lambda
+type lambdaResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *lambdaResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *lambdaResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *lambdaResponseWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+// response converts the collected response to the API Gateway REST format
+func (w *lambdaResponseWriter) response() *events.APIGatewayProxyResponse {
+	response := &events.APIGatewayProxyResponse{
+		StatusCode: w.code,
+		Headers:    make(map[string]string),
+		Body:       w.body.String(),
+	}
+	for key, values := range w.header {
+		response.Headers[key] = values[0]
+		if len(values) > 1 {
+			if response.MultiValueHeaders == nil {
+				response.MultiValueHeaders = make(map[string][]string)
+			}
+			response.MultiValueHeaders[key] = values
+		}
+	}
+	return response
+}
+
+// headersV2 converts the headers to the payload version 2.0 format used by HTTP APIs and function URLs.
+// Repeated headers are joined with commas and cookies are returned separately as Set-Cookie can't be joined.
+func (w *lambdaResponseWriter) headersV2() (map[string]string, []string) {
+	headers := make(map[string]string)
+	var cookies []string
+	for key, values := range w.header {
+		if key == "Set-Cookie" {
+			cookies = append(cookies, values...)
+			continue
+		}
+		headers[key] = strings.Join(values, ",")
+	}
+	return headers, cookies
+}
+
+// lambdaRequest is the part of a lambda event the handler needs
+type lambdaRequest struct {
+	method   string
+	sourceIP string
+
+	// ipHeader is a header holding the client IP set by the platform, see Handler.clientIP
+	ipHeader string
+
+	header   http.Header
+	body     string
+	isBase64 bool
+}
+
+// eventHeader merges an event's headers into a http.Header. Keys are canonicalized since API Gateway HTTP APIs and function URLs lowercase them.
+// Cookies are sent separately in payload version 2.0 and are added back as a Cookie header.
+func eventHeader(headers map[string]string, multi map[string][]string, cookies []string) http.Header {
+	header := make(http.Header)
+	for key, values := range multi {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	for key, value := range headers {
+		if len(header.Values(key)) < 1 {
+			header.Set(key, value)
+		}
+	}
+	if len(cookies) > 0 {
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	return header
+}
+
+// serveEvent handles a submission from a lambda event
+func (h *Handler) serveEvent(r lambdaRequest) *lambdaResponseWriter {
+	w := &lambdaResponseWriter{header: make(http.Header), code: http.StatusOK}
+	ip := h.clientIP(r.sourceIP, r.ipHeader, r.header)
+
+	code, location, err := h.handle(r.method, ip, func() (*formailer.Submission, error) {
+		size := len(r.body)
+		if r.isBase64 {
+			size = base64.StdEncoding.DecodedLen(size) - strings.Count(r.body[max(0, size-2):], "=")
+		}
+		if h.maxBodySize > 0 && int64(size) > h.maxBodySize {
+			return nil, &http.MaxBytesError{Limit: h.maxBodySize}
+		}
+		return h.config.ParseBody(r.header.Get("Content-Type"), r.body, r.isBase64, h.parseOptions()...)
+	})
+	h.respond(w, code, location, err)
+	return w
+}
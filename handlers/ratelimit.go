@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/torrayne/formailer"
+)
+
+// RateLimiter counts submissions against limits. The handlers use a MemoryLimiter unless WithRateLimiter sets another.
+// Implement it with a shared store like Redis when running several instances so they enforce the same limits.
+type RateLimiter interface {
+	// Allow takes one request from the bucket for key. When the limit has been reached it returns false and how long until a request is allowed.
+	Allow(key string, limit formailer.Limit) (bool, time.Duration, error)
+}
+
+// RateLimitError is returned when a submission is over a limit. The handlers respond with 429 Too Many Requests and a Retry-After header.
+type RateLimitError struct {
+	// Scope is the limit that was reached: ip, form or global.
+	Scope string
+
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded, retry in %ds", e.Scope, retrySeconds(e.RetryAfter))
+}
+
+// retrySeconds rounds up so clients never retry too early
+func retrySeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryLimiter is a RateLimiter keeping a token bucket per key in memory.
+// Serverless platforms run many short lived instances with their own memory so limits are per instance.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// NewMemoryLimiter creates an empty in-memory limiter.
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token from the key's bucket. Buckets start full with limit.Requests tokens and refill evenly over limit.Period.
+func (m *MemoryLimiter) Allow(key string, limit formailer.Limit) (bool, time.Duration, error) {
+	if !limit.Enabled() || limit.Period <= 0 {
+		return true, 0, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	capacity := float64(limit.Requests)
+	interval := limit.Period / time.Duration(limit.Requests)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.last))/float64(interval))
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) * float64(interval))
+		return false, wait, nil
+	}
+
+	b.tokens--
+	b.full = now.Add(time.Duration((capacity - b.tokens) * float64(interval)))
+	return true, 0, nil
+}
+
+// sweep drops buckets that have refilled since a full bucket is the same as a missing one
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// rateLimit checks the form's limits and the handler's global limit for the client
+func (h *Handler) rateLimit(form *formailer.Form, ip string) error {
+	id := strings.ToLower(or(form.ID, form.Name))
+	// The narrowest limit is checked first so one client going over its limit doesn't use up the form's or global limit
+	checks := []struct {
+		scope, key string
+		limit      formailer.Limit
+	}{
+		{"ip", "ip:" + id + ":" + ip, form.RateLimit.PerIP},
+		{"form", "form:" + id, form.RateLimit.PerForm},
+		{"global", "global", h.globalLimit},
+	}
+
+	for _, check := range checks {
+		if !check.limit.Enabled() {
+			continue
+		}
+		// Without an address every client would share one bucket so the per IP limit is skipped
+		if check.scope == "ip" && len(ip) < 1 {
+			h.unknownIP.Do(func() {
+				h.logger.Errorf("skipped the per ip rate limit of %s form since the client ip is unknown, see WithTrustedProxies", id)
+			})
+			continue
+		}
+
+		ok, wait, err := h.limiter.Allow(check.key, check.limit)
+		if err != nil {
+			// A broken limiter backend shouldn't stop forms from working
+			h.logger.Errorf("failed to check %s rate limit: %v", check.scope, err)
+			continue
+		}
+		if !ok {
+			return &RateLimitError{Scope: check.scope, RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// clientIP returns the address of the client. remote is the address of the connection, which can be empty when the platform doesn't share it.
+// platformHeader is a header the platform's edge always overwrites with the client address so it can be believed without a trusted proxy,
+// it must only be passed by the handler for that platform. Forwarding headers are only read when the request came through a trusted proxy.
+func (h *Handler) clientIP(remote, platformHeader string, header http.Header) string {
+	if len(platformHeader) > 0 {
+		if ip := strings.TrimSpace(header.Get(platformHeader)); net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !h.trusted(remote) {
+		return remote
+	}
+
+	// Every proxy appends the address it received the request from so the last untrusted address is the client
+	var forwarded []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(value, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(ip))
+		}
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if net.ParseIP(forwarded[i]) == nil {
+			break
+		}
+		if !h.trusted(forwarded[i]) || i == 0 {
+			return forwarded[i]
+		}
+	}
+
+	return remote
+}
+
+// trusted reports whether ip is a trusted proxy. When the connecting address is unknown any trusted proxy setting trusts it.
+func (h *Handler) trusted(ip string) bool {
+	if len(ip) < 1 {
+		return len(h.trustedProxies) > 0
+	}
+
+	addr := net.ParseIP(ip)
+	for _, network := range h.trustedProxies {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// netlifyIPHeader is set by Netlify's edge to the address that connected to it
+const netlifyIPHeader = "X-Nf-Client-Connection-Ip"
+
+// parseProxies converts IP addresses and CIDR ranges to networks
+func parseProxies(proxies []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 128
+			if v4 := ip.To4(); v4 != nil {
+				ip, bits = v4, 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func or(a, b string) string {
+	if len(a) > 0 {
+		return a
+	}
+	return b
+}
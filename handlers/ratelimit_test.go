@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/torrayne/formailer"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	m := NewMemoryLimiter()
+	m.now = func() time.Time { return now }
+	limit := formailer.Limit{Requests: 2, Period: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := m.Allow("a", limit); !ok {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	ok, wait, err := m.Allow("a", limit)
+	if ok || err != nil || wait != 30*time.Second {
+		t.Errorf("Expected the third request to wait 30s; Got: %v %s %v", ok, wait, err)
+	}
+	if ok, _, _ := m.Allow("b", limit); !ok {
+		t.Error("Expected other keys to have their own bucket")
+	}
+
+	now = now.Add(20 * time.Second)
+	if _, wait, _ := m.Allow("a", limit); wait != 10*time.Second {
+		t.Errorf("Expected the bucket to refill over time \nExpected: 10s; Got: %s", wait)
+	}
+
+	now = now.Add(10 * time.Second)
+	if ok, _, _ := m.Allow("a", limit); !ok {
+		t.Error("Expected a request to be allowed once a token refilled")
+	}
+
+	now = now.Add(time.Hour)
+	m.Allow("c", limit)
+	if _, ok := m.buckets["a"]; ok {
+		t.Error("Expected refilled buckets to be swept")
+	}
+
+	if ok, _, _ := m.Allow("a", formailer.Limit{}); !ok {
+		t.Error("Expected a zero limit to allow everything")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		proxies   []string
+		remote    string
+		forwarded string
+		netlify   string
+		onNetlify bool
+		ip        string
+	}{
+		{nil, "203.0.113.9:5000", "198.51.100.1", "", false, "203.0.113.9"},
+		{[]string{"10.0.0.0/8"}, "203.0.113.9:5000", "198.51.100.1", "", false, "203.0.113.9"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.2:5000", "198.51.100.1", "", false, "198.51.100.1"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.2:5000", "192.0.2.7, 198.51.100.1, 10.0.0.3", "", false, "198.51.100.1"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.2:5000", "10.0.0.4, 10.0.0.3", "", false, "10.0.0.4"},
+		{[]string{"10.0.0.2"}, "10.0.0.2:5000", "", "", false, "10.0.0.2"},
+		{[]string{"::1"}, "[::1]:5000", "2001:db8::1", "", false, "2001:db8::1"},
+		// Only Netlify's edge overwrites its header so anywhere else the client could have sent it
+		{[]string{"10.0.0.2"}, "10.0.0.2:5000", "", "198.51.100.1", false, "10.0.0.2"},
+		{[]string{"10.0.0.0/8"}, "10.0.0.2:5000", "198.51.100.1", "192.0.2.7", false, "198.51.100.1"},
+		{[]string{"0.0.0.0/0"}, "", "198.51.100.1", "192.0.2.7", false, "198.51.100.1"},
+		{nil, "", "198.51.100.1", "192.0.2.7", true, "192.0.2.7"},
+		{nil, "", "198.51.100.1", "", true, ""},
+		{[]string{"0.0.0.0/0"}, "", "198.51.100.1", "", true, "198.51.100.1"},
+	}
+
+	for _, test := range tests {
+		h := newHandler(nil, WithTrustedProxies(test.proxies...))
+
+		header := make(http.Header)
+		if len(test.forwarded) > 0 {
+			header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if len(test.netlify) > 0 {
+			header.Set("X-Nf-Client-Connection-Ip", test.netlify)
+		}
+		ipHeader := ""
+		if test.onNetlify {
+			ipHeader = netlifyIPHeader
+		}
+
+		if ip := h.clientIP(test.remote, ipHeader, header); ip != test.ip {
+			t.Errorf("Unexpected client ip for %v from %s %q %q on Netlify %t \nExpected: %s; Got: %s", test.proxies, test.remote, test.forwarded, test.netlify, test.onNetlify, test.ip, ip)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for an invalid trusted proxy")
+		}
+	}()
+	WithTrustedProxies("10.0.0.0/33")
+}
+
+func TestHandlerRateLimit(t *testing.T) {
+	var sent int
+	c := testConfig(&sent)
+	c["contact"].RateLimit = formailer.RateLimit{
+		PerIP:   formailer.Limit{Requests: 1, Period: time.Minute},
+		PerForm: formailer.Limit{Requests: 3, Period: time.Hour},
+	}
+	h := New(c)
+
+	post := func(ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("_form_name=contact&email=a@example.com"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = ip + ":5000"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := post("192.0.2.1"); w.Code != http.StatusOK {
+		t.Fatalf("Expected the first submission to be sent; Got: %d %s", w.Code, w.Body)
+	}
+
+	w := post("192.0.2.1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected 429 with Retry-After 60; Got: %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(w.Body.String(), "ip rate limit exceeded, retry in 60s") {
+		t.Errorf("Unexpected response: %s", w.Body)
+	}
+
+	post("192.0.2.2")
+	post("192.0.2.3")
+	if w := post("192.0.2.4"); w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "form rate limit") {
+		t.Errorf("Expected the form limit to be reached; Got: %d %s", w.Code, w.Body)
+	}
+	if sent != 3 {
+		t.Errorf("Unexpected number of emails sent \nExpected: 3; Got: %d", sent)
+	}
+
+	h = New(testConfig(&sent), WithGlobalRateLimit(formailer.Limit{Requests: 1, Period: time.Second}))
+	post("192.0.2.1")
+	if w := post("192.0.2.2"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected the global limit to be reached; Got: %d %s", w.Code, w.Body)
+	}
+}
+
+// failingLimiter is a backend that can't be reached
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(string, formailer.Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func TestNetlifyRateLimit(t *testing.T) {
+	var sent int
+	c := testConfig(&sent)
+	c["contact"].RateLimit.PerIP = formailer.Limit{Requests: 1, Period: time.Hour}
+
+	post := func(handler func(events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error), ip string) int {
+		response, err := handler(events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodPost,
+			Headers:    map[string]string{"content-type": "application/x-www-form-urlencoded", "x-nf-client-connection-ip": ip},
+			Body:       "_form_name=contact&email=a@example.com",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.StatusCode
+	}
+
+	handler := Netlify(c)
+	codes := []int{post(handler, "192.0.2.1"), post(handler, "192.0.2.2"), post(handler, "192.0.2.1")}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("Expected only the repeated address to be limited; Got: %v", codes)
+	}
+
+	handler = Netlify(c, WithRateLimiter(failingLimiter{}))
+	if code := post(handler, "192.0.2.1"); code != http.StatusOK {
+		t.Errorf("Expected submissions to be allowed when the limiter fails; Got: %d", code)
+	}
+
+	l := new(testLogger)
+	handler = Netlify(c, WithLogger(l))
+	post(handler, "")
+	post(handler, "")
+	warnings := 0
+	for _, m := range l.messages {
+		if strings.Contains(m, "client ip is unknown") {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("Expected one warning about the unknown client ip; Got: %q", l.messages)
+	}
+}
+
+func TestVercelRateLimit(t *testing.T) {
+	var sent int
+	c := testConfig(&sent)
+	c["contact"].RateLimit.PerIP = formailer.Limit{Requests: 1, Period: time.Hour}
+
+	post := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("_form_name=contact&email=a@example.com"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = "192.0.2.10:5000"
+		w := httptest.NewRecorder()
+		Vercel(c, w, r)
+		return w.Code
+	}
+
+	if code := post(); code != http.StatusOK {
+		t.Fatalf("Expected the first submission to be sent; Got: %d", code)
+	}
+	if code := post(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the limit to carry over between requests; Got: %d", code)
+	}
+	if sent != 1 {
+		t.Errorf("Unexpected number of emails sent \nExpected: 1; Got: %d", sent)
+	}
+}
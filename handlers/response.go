@@ -1,6 +1,92 @@
 package handlers
 
-type response struct {
-	Ok    bool
-	Error string `json:",omitempty"`
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/torrayne/formailer"
+)
+
+// Response is written by the built-in handlers after every submission.
+type Response struct {
+	Ok         bool
+	Error      string                 `json:",omitempty"`
+	Fields     []formailer.FieldError `json:",omitempty"`
+	Deliveries []Delivery             `json:",omitempty"`
+}
+
+// Delivery reports whether a single email was sent. They are listed when some of a submission's emails fail.
+// Errors aren't included since they can expose server names and provider responses, the handlers log them instead.
+type Delivery struct {
+	ID        string
+	AutoReply bool `json:",omitempty"`
+	Ok        bool
+}
+
+// fail marks the response as failed and lists any invalid fields
+func (r *Response) fail(err error) {
+	r.Ok = false
+	r.Error = err.Error()
+
+	var invalid formailer.ValidationError
+	if errors.As(err, &invalid) {
+		r.Fields = invalid
+	}
+
+	var failed *formailer.SendError
+	if errors.As(err, &failed) {
+		r.Error = fmt.Sprintf("failed to send %d of %d emails", len(failed.Failed()), len(failed.Results))
+		for i, result := range failed.Results {
+			// Recipients aren't included since they are usually private addresses
+			d := Delivery{ID: result.ID, AutoReply: result.AutoReply, Ok: result.Err == nil}
+			if len(d.ID) < 1 && d.AutoReply {
+				d.ID = "auto-reply"
+			} else if len(d.ID) < 1 {
+				d.ID = fmt.Sprintf("email-%d", i+1)
+			}
+			r.Deliveries = append(r.Deliveries, d)
+		}
+	}
+}
+
+// Format writes the response with the status code.
+type Format func(w http.ResponseWriter, code int, r Response)
+
+// JSON writes the response as a JSON object. It is the default format.
+func JSON(w http.ResponseWriter, code int, r Response) {
+	body, err := json.Marshal(r)
+	if err != nil {
+		body = []byte(`{"Ok":false}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// Text writes the response as plain text. ok on success or the error followed by each invalid field or delivery on its own line.
+func Text(w http.ResponseWriter, code int, r Response) {
+	body := new(strings.Builder)
+	if r.Ok {
+		body.WriteString("ok\n")
+	} else {
+		body.WriteString(r.Error + "\n")
+	}
+	for _, f := range r.Fields {
+		fmt.Fprintf(body, "%s: %s\n", f.Field, f.Message)
+	}
+	for _, d := range r.Deliveries {
+		status := "ok"
+		if !d.Ok {
+			status = "failed"
+		}
+		fmt.Fprintf(body, "%s: %s\n", d.ID, status)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write([]byte(body.String()))
 }
@@ -0,0 +1,130 @@
+package formailer
+
+import (
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// Priority is the importance of an email shown by mail clients.
+type Priority string
+
+// Priorities for Email.Priority. An empty Priority is the same as PriorityNormal.
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// priorityHeaders maps priorities to their X-Priority and Importance values
+var priorityHeaders = map[Priority][2]string{
+	PriorityHigh: {"1 (Highest)", "High"},
+	PriorityLow:  {"5 (Lowest)", "Low"},
+}
+
+// reservedHeaders are set by Formailer or describe the MIME structure so they can't be set with Email.Headers.
+// The value explains what to use instead.
+var reservedHeaders = map[string]string{
+	"From":                      "use From",
+	"To":                        "use To",
+	"Cc":                        "use Cc",
+	"Bcc":                       "use Bcc",
+	"Reply-To":                  "use ReplyTo",
+	"Subject":                   "use Subject",
+	"Sender":                    "use From",
+	"Return-Path":               "it is set by the receiving server",
+	"Date":                      "it is set when the email is generated",
+	"Message-Id":                "it is generated for every email",
+	"In-Reply-To":               "use Form.ThreadField",
+	"References":                "use Form.ThreadField",
+	"X-Formailer-Submission-Id": "it is set from Submission.ID",
+	"Mime-Version":              "it describes the message structure",
+	"Content-Type":              "it describes the message structure",
+	"Content-Transfer-Encoding": "it describes the message structure",
+	"Content-Disposition":       "it describes the message structure",
+	"Dkim-Signature":            "configure DKIM instead",
+	"X-Priority":                "use Priority",
+	"Importance":                "use Priority",
+	"X-Mailgun-Tag":             "use Tags",
+	"X-Pm-Tag":                  "use Tags",
+}
+
+// validateHeader returns an error when name isn't a valid header field name or is reserved
+func validateHeader(name string) error {
+	if len(name) < 1 {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	for _, c := range name {
+		// RFC 5322 field names are printable ASCII excluding the colon
+		if c < 33 || c > 126 || c == ':' {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+	}
+	if reason, ok := reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)]; ok {
+		return fmt.Errorf("header %s can't be set, %s", name, reason)
+	}
+	return nil
+}
+
+// validatePriority returns an error for unknown priorities
+func validatePriority(p Priority) error {
+	switch p {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return nil
+	}
+	return fmt.Errorf("invalid priority %q must be one of high, normal or low", p)
+}
+
+// addHeaders adds the custom headers, priority, and tags to the email
+func (e *Email) addHeaders(email *mail.Email, s *Submission) error {
+	names := make([]string, 0, len(e.Headers))
+	for name := range e.Headers {
+		if err := validateHeader(name); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := renderHeader(name, e.Headers[name], s)
+		if err != nil {
+			return err
+		}
+		// Empty headers are left out so optional values can be templated
+		if len(value) > 0 {
+			email.AddHeader(name, value)
+		}
+	}
+
+	if err := validatePriority(e.Priority); err != nil {
+		return err
+	}
+	if values, ok := priorityHeaders[e.Priority]; ok {
+		email.AddHeader("X-Priority", values[0])
+		email.AddHeader("Importance", values[1])
+	}
+
+	// Repeated headers aren't supported so only the first tag is sent in headers.
+	// The Mailgun and SendGrid senders pass every tag to their APIs.
+	if tags := e.tags(); len(tags) > 0 {
+		email.AddHeader("X-Mailgun-Tag", tags[0])
+		email.AddHeader("X-PM-Tag", tags[0])
+	}
+
+	return nil
+}
+
+// tags returns the email's tags with blanks removed
+func (e *Email) tags() []string {
+	var tags []string
+	for _, tag := range e.Tags {
+		if tag = strings.TrimSpace(sanitizeHeader(tag)); len(tag) > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,65 @@
+package formailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmailHeaders(t *testing.T) {
+	e := &Email{
+		To:   "to@example.com",
+		From: "noreply@example.com",
+		Headers: map[string]string{
+			"List-Unsubscribe": "<mailto:unsubscribe@example.com?subject={{first .Values.email}}>",
+			"X-Campaign":       "{{first .Values.campaign}}",
+			"X-Form":           "contact\r\nBcc: victim@example.com",
+		},
+		Priority: PriorityHigh,
+		Tags:     []string{" ", "contact", "website"},
+	}
+	s := &Submission{Form: testForm, Values: map[string]interface{}{"email": "person@example.com"}}
+
+	email, err := e.Email(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := parseMessage(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"List-Unsubscribe": "<mailto:unsubscribe@example.com?subject=person@example.com>",
+		"X-Form":           "contact  Bcc: victim@example.com",
+		"X-Priority":       "1 (Highest)",
+		"Importance":       "High",
+		"X-Mailgun-Tag":    "contact",
+		"X-Pm-Tag":         "contact",
+	}
+	for name, value := range expected {
+		if m.Headers[name] != value {
+			t.Errorf("Unexpected %s header \nExpected: %q; Got: %q", name, value, m.Headers[name])
+		}
+	}
+	if _, ok := m.Headers["X-Campaign"]; ok {
+		t.Error("Expected empty header to be left out")
+	}
+	if len(m.Bcc) > 0 {
+		t.Errorf("Expected header injection to be stopped; Got: %v", m.Bcc)
+	}
+}
+
+func TestReservedHeaders(t *testing.T) {
+	s := &Submission{Form: testForm}
+	for _, name := range []string{"message-id", "Content-Type", "BCC", "X Space", "X:Colon", ""} {
+		e := &Email{To: "to@example.com", From: "noreply@example.com", Headers: map[string]string{name: "value"}}
+		if _, err := e.Email(s); err == nil {
+			t.Errorf("Expected header %q to be refused", name)
+		}
+	}
+
+	e := &Email{To: "to@example.com", From: "noreply@example.com", Priority: "urgent"}
+	if _, err := e.Email(s); err == nil || !strings.Contains(err.Error(), "invalid priority") {
+		t.Errorf("Expected invalid priority error; Got: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package formailer
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	simplemail "github.com/xhit/go-simple-mail/v2"
+)
+
+// MailgunSender sends emails using the Mailgun MIME messages API so the message is delivered exactly as generated.
+// The API key and domain are read from MAILGUN_<ID>_API_KEY and MAILGUN_<ID>_DOMAIN falling back on MAILGUN_API_KEY and MAILGUN_DOMAIN.
+type MailgunSender struct {
+	// BaseURL defaults to https://api.mailgun.net. Use https://api.eu.mailgun.net for EU domains.
+	BaseURL string
+
+	// Client is used to make requests, when nil apiClient is used.
+	Client *http.Client
+}
+
+// Send posts the email to the Mailgun API.
+func (s MailgunSender) Send(e *Email, email *simplemail.Email) error {
+	key, err := e.requireEnv("Mailgun", "MAILGUN", "API_KEY")
+	if err != nil {
+		return err
+	}
+	domain, err := e.requireEnv("Mailgun", "MAILGUN", "DOMAIN")
+	if err != nil {
+		return err
+	}
+	if email.GetError() != nil {
+		return email.GetError()
+	}
+
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	// The recipients include Bcc which isn't in the message headers
+	w.WriteField("to", strings.Join(email.GetRecipients(), ","))
+	for _, tag := range e.tags() {
+		w.WriteField("o:tag", tag)
+	}
+	part, err := w.CreateFormFile("message", "message.mime")
+	if err != nil {
+		return err
+	}
+	part.Write([]byte(rawMessage(email)))
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(or(s.BaseURL, "https://api.mailgun.net"), "/") + "/v3/" + domain + "/messages.mime"
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.SetBasicAuth("api", key)
+
+	return do(s.Client, req)
+}
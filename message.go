@@ -0,0 +1,167 @@
+package formailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	simplemail "github.com/xhit/go-simple-mail/v2"
+)
+
+// message is a generated email broken back down into its parts for HTTP APIs that don't accept raw MIME
+type message struct {
+	From        *mail.Address
+	To          []*mail.Address
+	Cc          []*mail.Address
+	Bcc         []*mail.Address
+	ReplyTo     []*mail.Address
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+
+	// Headers are any headers not covered by the fields above, such as Message-Id
+	Headers map[string]string
+
+	// Raw is the full MIME message
+	Raw []byte
+}
+
+// structuralHeaders are represented by message fields or describe the MIME structure
+var structuralHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Reply-To": true, "Subject": true,
+	"Date": true, "Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+	// The signature won't match a message rebuilt by an HTTP API
+	"Dkim-Signature": true,
+}
+
+func parseMessage(email *simplemail.Email) (*message, error) {
+	if email.GetError() != nil {
+		return nil, email.GetError()
+	}
+
+	raw := []byte(rawMessage(email))
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	m := &message{Raw: raw, Headers: make(map[string]string)}
+	dec := new(mime.WordDecoder)
+
+	m.Subject, err = dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode subject: %w", err)
+	}
+
+	from, err := msg.Header.AddressList("From")
+	if err != nil || len(from) < 1 {
+		return nil, fmt.Errorf("invalid from address: %v", err)
+	}
+	m.From = from[0]
+
+	for header, list := range map[string]*[]*mail.Address{"To": &m.To, "Cc": &m.Cc, "Reply-To": &m.ReplyTo} {
+		if len(msg.Header.Get(header)) < 1 {
+			continue
+		}
+		*list, err = msg.Header.AddressList(header)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s address: %w", header, err)
+		}
+	}
+
+	// Bcc isn't written to the headers so anyone left over in the recipients is a Bcc
+	visible := make(map[string]bool)
+	for _, a := range append(m.To, m.Cc...) {
+		visible[strings.ToLower(a.Address)] = true
+	}
+	for _, r := range email.GetRecipients() {
+		if !visible[strings.ToLower(r)] {
+			m.Bcc = append(m.Bcc, &mail.Address{Address: r})
+		}
+	}
+
+	for key := range msg.Header {
+		if !structuralHeaders[textproto.CanonicalMIMEHeaderKey(key)] {
+			m.Headers[key] = msg.Header.Get(key)
+		}
+	}
+
+	err = m.readPart(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message body: %w", err)
+	}
+	return m, nil
+}
+
+// readPart reads a MIME part recursively storing the text, html, and attachments
+func (m *message) readPart(header textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(or(header.Get("Content-Type"), "text/plain"))
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := m.readPart(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	_, disposition, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := or(disposition["filename"], params["name"])
+	switch {
+	case len(filename) > 0:
+		m.Attachments = append(m.Attachments, Attachment{Filename: filename, MimeType: mediaType, Data: data})
+	case mediaType == "text/html":
+		m.HTML = string(data)
+	default:
+		m.Text = string(data)
+	}
+	return nil
+}
+
+// rawMessage returns the message exactly as it should be sent, including the DKIM signature when it was signed
+func rawMessage(email *simplemail.Email) string {
+	if len(email.DkimMsg) > 0 {
+		return email.DkimMsg
+	}
+	return email.GetMessage()
+}
+
+// addresses formats a list of addresses for headers
+func addresses(list []*mail.Address) []string {
+	s := make([]string, len(list))
+	for i, a := range list {
+		s[i] = a.String()
+	}
+	return s
+}
@@ -0,0 +1,224 @@
+package formailer
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// defaultTokenURL is Google's token endpoint. Microsoft 365 uses https://login.microsoftonline.com/<tenant>/oauth2/v2.0/token.
+const defaultTokenURL = "https://oauth2.googleapis.com/token"
+
+// oauthToken is a cached access token
+type oauthToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	expires     time.Time
+}
+
+// oauthCacheEntry holds the token for one refresh token. Its lock is held while refreshing so concurrent sends
+// wait for a single refresh without blocking sends that use other credentials.
+type oauthCacheEntry struct {
+	sync.Mutex
+	token *oauthToken
+}
+
+var (
+	oauthTokens   = make(map[string]*oauthCacheEntry)
+	oauthTokensMu sync.Mutex
+)
+
+// oauthClient gives up on a token endpoint that doesn't respond so sends aren't left hanging until the platform kills the function
+var oauthClient = &http.Client{Timeout: 10 * time.Second}
+
+// usesXOAUTH2 reports whether the email authenticates with OAuth2 instead of a password
+func (e *Email) usesXOAUTH2() bool {
+	auth, _ := e.smtpEnv("AUTH")
+	return strings.EqualFold(auth, "xoauth2")
+}
+
+// accessToken returns a cached access token or uses the refresh token to get a new one.
+// Tokens are refreshed a minute before they expire.
+func (e *Email) accessToken(client *http.Client) (string, error) {
+	prefix := fmt.Sprintf("SMTP_%s_", strings.ToUpper(e.ID))
+	tokenURL, _ := e.smtpEnv("OAUTH_TOKEN_URL")
+	tokenURL = or(tokenURL, defaultTokenURL)
+	scope, _ := e.smtpEnv("OAUTH_SCOPE")
+
+	settings := map[string]string{}
+	for _, key := range []string{"OAUTH_CLIENT_ID", "OAUTH_CLIENT_SECRET", "OAUTH_REFRESH_TOKEN"} {
+		settings[key], _ = e.smtpEnv(key)
+		if len(settings[key]) < 1 {
+			return "", fmt.Errorf("incomplete SMTP configuration missing %s%s or SMTP_%s for %s", prefix, key, key, e.ID)
+		}
+	}
+
+	cacheKey := strings.Join([]string{tokenURL, settings["OAUTH_CLIENT_ID"], settings["OAUTH_REFRESH_TOKEN"]}, "\x00")
+	oauthTokensMu.Lock()
+	entry, ok := oauthTokens[cacheKey]
+	if !ok {
+		entry = new(oauthCacheEntry)
+		oauthTokens[cacheKey] = entry
+	}
+	oauthTokensMu.Unlock()
+
+	entry.Lock()
+	defer entry.Unlock()
+	if entry.token != nil && time.Now().Before(entry.token.expires) {
+		return entry.token.AccessToken, nil
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("client_id", settings["OAUTH_CLIENT_ID"])
+	data.Set("client_secret", settings["OAUTH_CLIENT_SECRET"])
+	data.Set("refresh_token", settings["OAUTH_REFRESH_TOKEN"])
+	if len(scope) > 0 {
+		data.Set("scope", scope)
+	}
+
+	if client == nil {
+		client = oauthClient
+	}
+	resp, err := client.PostForm(tokenURL, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to refresh access token: %s responded with %s", resp.Request.URL.Host, resp.Status)
+	}
+
+	token := new(oauthToken)
+	err = json.NewDecoder(resp.Body).Decode(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode access token: %w", err)
+	}
+	if len(token.AccessToken) < 1 {
+		return "", errors.New("failed to refresh access token: response is missing access_token")
+	}
+
+	token.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	entry.token = token
+	return token.AccessToken, nil
+}
+
+// xoauth2Auth implements the XOAUTH2 SASL mechanism used by Gmail and Microsoft 365
+type xoauth2Auth struct {
+	user, token string
+}
+
+func (a xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("refusing to send access token over an unencrypted connection")
+	}
+	return "XOAUTH2", []byte("user=" + a.user + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+func (a xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sent a JSON error, respond with an empty message to get the final error reply
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+func isLocalhost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// sendXOAUTH2 delivers the email using net/smtp since go-simple-mail doesn't support XOAUTH2
+func sendXOAUTH2(e *Email, server *mail.SMTPServer, email *mail.Email) error {
+	if email.GetError() != nil {
+		return email.GetError()
+	}
+
+	token, err := e.accessToken(nil)
+	if err != nil {
+		return err
+	}
+
+	return deliverXOAUTH2(server, token, email)
+}
+
+// deliverXOAUTH2 connects, authenticates with the access token, and sends the email
+func deliverXOAUTH2(server *mail.SMTPServer, token string, email *mail.Email) error {
+	tlsConfig := server.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: server.Host}
+	}
+
+	conn, err := dialSMTP(server)
+	if err != nil {
+		return err
+	}
+	setDeadline(conn, server.ConnectTimeout)
+
+	c, err := smtp.NewClient(conn, server.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if len(server.Helo) > 0 {
+		if err := c.Hello(server.Helo); err != nil {
+			return err
+		}
+	}
+	if server.Encryption == mail.EncryptionTLS || server.Encryption == mail.EncryptionSTARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Auth(xoauth2Auth{user: server.Username, token: token}); err != nil {
+		return fmt.Errorf("XOAUTH2 authentication failed: %w", err)
+	}
+
+	setDeadline(conn, server.SendTimeout)
+	if err := sendTimedOut(sendXOAUTH2Message(c, email)); err != nil {
+		return err
+	}
+	c.Quit()
+	return nil
+}
+
+// sendXOAUTH2Message sends the envelope and message over the authenticated connection
+func sendXOAUTH2Message(c *smtp.Client, email *mail.Email) error {
+	if err := c.Mail(email.GetFrom()); err != nil {
+		return err
+	}
+	for _, r := range email.GetRecipients() {
+		if err := c.Rcpt(r); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(rawMessage(email))); err != nil {
+		return err
+	}
+	return w.Close()
+}
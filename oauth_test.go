@@ -0,0 +1,146 @@
+package formailer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestXOAUTH2(t *testing.T) {
+	var requests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != "refresh" || r.PostForm.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"access","expires_in":3600,"token_type":"Bearer"}`)
+	}))
+	defer tokenServer.Close()
+
+	server := newFakeSMTP(t)
+	server.Setenv(t, "oauth")
+	t.Setenv("SMTP_OAUTH_AUTH", "xoauth2")
+	t.Setenv("SMTP_OAUTH_USER", "forms@example.com")
+	t.Setenv("SMTP_OAUTH_PASS", "")
+	t.Setenv("SMTP_OAUTH_OAUTH_CLIENT_ID", "client")
+	t.Setenv("SMTP_OAUTH_OAUTH_CLIENT_SECRET", "secret")
+	t.Setenv("SMTP_OAUTH_OAUTH_REFRESH_TOKEN", "refresh")
+	t.Setenv("SMTP_OAUTH_OAUTH_TOKEN_URL", tokenServer.URL)
+
+	e := &Email{ID: "oauth", To: "to@example.com", From: "forms@example.com", Bcc: []string{"bcc@example.com"}, Subject: "OAuth"}
+	s := &Submission{Form: testForm, Values: map[string]interface{}{"message": "Hello"}}
+	for i := 0; i < 2; i++ {
+		email, err := e.Email(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := (SMTPSender{}).Send(e, email); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("Expected access token to be cached \nExpected: 1 request; Got: %d", requests)
+	}
+
+	expected := "XOAUTH2 user=forms@example.com\x01auth=Bearer access\x01\x01"
+	auths := server.Auths()
+	if len(auths) != 2 || auths[0] != expected {
+		t.Errorf("Unexpected auth \nExpected: %q; Got: %q", expected, auths)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages; Got: %d", len(messages))
+	}
+	if messages[0].From != "forms@example.com" || strings.Join(messages[0].To, ",") != "to@example.com,bcc@example.com" {
+		t.Errorf("Unexpected envelope: %+v", messages[0])
+	}
+	if !strings.Contains(messages[0].Data, "Subject: OAuth") || strings.Contains(messages[0].Data, "bcc@example.com") {
+		t.Errorf("Unexpected message data: %s", messages[0].Data)
+	}
+}
+
+func TestXOAUTH2Errors(t *testing.T) {
+	t.Setenv("SMTP_HOST", "mail.example.com")
+	t.Setenv("SMTP_PORT", "587")
+	t.Setenv("SMTP_AUTH", "XOAUTH2")
+	t.Setenv("SMTP_USER", "")
+	t.Setenv("SMTP_PASS", "")
+
+	if _, err := (&Email{ID: "xoauth"}).server(); err == nil || !strings.Contains(err.Error(), "SMTP_XOAUTH_USER or SMTP_USER") {
+		t.Errorf("Expected missing user error; Got: %v", err)
+	}
+
+	t.Setenv("SMTP_USER", "forms@example.com")
+	if _, err := (&Email{ID: "xoauth"}).server(); err != nil {
+		t.Errorf("Expected password to be optional with xoauth2; Got: %v", err)
+	}
+
+	if _, err := (&Email{ID: "xoauth"}).accessToken(nil); err == nil || !strings.Contains(err.Error(), "SMTP_XOAUTH_OAUTH_CLIENT_ID or SMTP_OAUTH_CLIENT_ID") {
+		t.Errorf("Expected missing client id error; Got: %v", err)
+	}
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid_grant"}`)
+	}))
+	defer tokenServer.Close()
+
+	t.Setenv("SMTP_OAUTH_CLIENT_ID", "client")
+	t.Setenv("SMTP_OAUTH_CLIENT_SECRET", "secret")
+	t.Setenv("SMTP_OAUTH_REFRESH_TOKEN", "expired")
+	t.Setenv("SMTP_OAUTH_TOKEN_URL", tokenServer.URL)
+	if _, err := (&Email{ID: "xoauth"}).accessToken(nil); err == nil || !strings.Contains(err.Error(), "400 Bad Request") {
+		t.Errorf("Expected token refresh error; Got: %v", err)
+	}
+
+	if _, _, err := (xoauth2Auth{user: "u", token: "t"}).Start(&smtp.ServerInfo{Name: "mail.example.com"}); err == nil {
+		t.Error("Expected XOAUTH2 to refuse an unencrypted connection")
+	}
+}
+
+func TestAccessTokenStalled(t *testing.T) {
+	stalled := make(chan struct{})
+	release := make(chan struct{})
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("refresh_token") == "stalled" {
+			close(stalled)
+			<-release
+		}
+		fmt.Fprint(w, `{"access_token":"access","expires_in":3600,"token_type":"Bearer"}`)
+	}))
+	defer tokenServer.Close()
+	defer close(release)
+
+	t.Setenv("SMTP_OAUTH_CLIENT_ID", "client")
+	t.Setenv("SMTP_OAUTH_CLIENT_SECRET", "secret")
+	t.Setenv("SMTP_OAUTH_TOKEN_URL", tokenServer.URL)
+	t.Setenv("SMTP_STALLED_OAUTH_REFRESH_TOKEN", "stalled")
+	t.Setenv("SMTP_WORKING_OAUTH_REFRESH_TOKEN", "working")
+
+	go (&Email{ID: "stalled"}).accessToken(nil)
+	<-stalled
+
+	done := make(chan error)
+	go func() {
+		_, err := (&Email{ID: "working"}).accessToken(nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected a stalled token refresh not to block other credentials")
+	}
+}
@@ -0,0 +1,97 @@
+package formailer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	simplemail "github.com/xhit/go-simple-mail/v2"
+)
+
+// PostmarkSender sends emails using the Postmark email API.
+// The server token is read from POSTMARK_<ID>_SERVER_TOKEN falling back on POSTMARK_SERVER_TOKEN.
+// POSTMARK_<ID>_MESSAGE_STREAM or POSTMARK_MESSAGE_STREAM can optionally set the message stream.
+type PostmarkSender struct {
+	// BaseURL defaults to https://api.postmarkapp.com.
+	BaseURL string
+
+	// Client is used to make requests, when nil apiClient is used.
+	Client *http.Client
+}
+
+type postmarkHeader struct {
+	Name  string
+	Value string
+}
+
+type postmarkAttachment struct {
+	Name        string
+	Content     string
+	ContentType string
+}
+
+type postmarkMessage struct {
+	From          string
+	To            string
+	Cc            string `json:",omitempty"`
+	Bcc           string `json:",omitempty"`
+	ReplyTo       string `json:",omitempty"`
+	Subject       string
+	TextBody      string               `json:",omitempty"`
+	HtmlBody      string               `json:",omitempty"`
+	Tag           string               `json:",omitempty"`
+	Headers       []postmarkHeader     `json:",omitempty"`
+	Attachments   []postmarkAttachment `json:",omitempty"`
+	MessageStream string               `json:",omitempty"`
+}
+
+// Send posts the email to the Postmark API.
+func (s PostmarkSender) Send(e *Email, email *simplemail.Email) error {
+	token, err := e.requireEnv("Postmark", "POSTMARK", "SERVER_TOKEN")
+	if err != nil {
+		return err
+	}
+
+	m, err := parseMessage(email)
+	if err != nil {
+		return err
+	}
+
+	body := postmarkMessage{
+		From:          m.From.String(),
+		To:            strings.Join(addresses(m.To), ", "),
+		Cc:            strings.Join(addresses(m.Cc), ", "),
+		Bcc:           strings.Join(addresses(m.Bcc), ", "),
+		ReplyTo:       strings.Join(addresses(m.ReplyTo), ", "),
+		Subject:       m.Subject,
+		TextBody:      m.Text,
+		HtmlBody:      m.HTML,
+		MessageStream: e.env("POSTMARK", "MESSAGE_STREAM"),
+	}
+	// Postmark only allows a single tag
+	if tags := e.tags(); len(tags) > 0 {
+		body.Tag = tags[0]
+	}
+	for name, value := range m.Headers {
+		body.Headers = append(body.Headers, postmarkHeader{Name: name, Value: value})
+	}
+	for _, a := range m.Attachments {
+		body.Attachments = append(body.Attachments, postmarkAttachment{
+			Name:        a.Filename,
+			Content:     base64.StdEncoding.EncodeToString(a.Data),
+			ContentType: a.MimeType,
+		})
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(or(s.BaseURL, "https://api.postmarkapp.com"), "/") + "/email"
+	return post(s.Client, url, "application/json", b, map[string]string{
+		"Accept":                  "application/json",
+		"X-Postmark-Server-Token": token,
+	})
+}
@@ -0,0 +1,49 @@
+package formailer
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limit allows Requests submissions every Period. Up to Requests can arrive at once after which they are spread over the period.
+// A zero Limit doesn't limit anything.
+type Limit struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Requests > 0
+}
+
+// validate returns an error for limits that can't be enforced
+func (l Limit) validate() error {
+	if l.Requests < 0 {
+		return fmt.Errorf("rate limit requests %d can't be negative", l.Requests)
+	}
+	if l.Requests > 0 && l.Period <= 0 {
+		return fmt.Errorf("rate limit of %d requests is missing period", l.Requests)
+	}
+	return nil
+}
+
+// RateLimit limits how many submissions the built-in handlers accept for a form.
+type RateLimit struct {
+	// PerIP limits each client IP address.
+	PerIP Limit `yaml:"per_ip"`
+
+	// PerForm limits the form as a whole no matter who submits it.
+	PerForm Limit `yaml:"per_form"`
+}
+
+// validate returns the first invalid limit
+func (r RateLimit) validate() error {
+	if err := r.PerIP.validate(); err != nil {
+		return fmt.Errorf("per_ip %w", err)
+	}
+	if err := r.PerForm.validate(); err != nil {
+		return fmt.Errorf("per_form %w", err)
+	}
+	return nil
+}
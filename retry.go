@@ -0,0 +1,127 @@
+package formailer
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/textproto"
+	"time"
+)
+
+// RetryPolicy retries transient delivery failures with exponential backoff. See IsTransient for which errors are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first. Zero or one disables retries.
+	MaxAttempts int `yaml:"max_attempts"`
+
+	// BaseDelay is the wait before the second attempt. It doubles after every attempt. Defaults to 1s.
+	BaseDelay time.Duration `yaml:"base_delay"`
+
+	// MaxDelay caps the wait between attempts. Zero leaves it uncapped.
+	MaxDelay time.Duration `yaml:"max_delay"`
+
+	// Jitter randomly shortens each wait by up to this fraction, between 0 and 1, so retries from many submissions don't line up.
+	Jitter float64 `yaml:"jitter"`
+
+	// Deadline is the total time allowed for every attempt, measured from the first.
+	// No retry is started that would wait past it, so keep it under your platform's function timeout.
+	// A running attempt isn't interrupted, that is limited by the SMTP timeouts.
+	Deadline time.Duration `yaml:"deadline"`
+}
+
+// delay returns how long to wait before the attempt after the given one
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	if d <= 0 {
+		d = time.Second
+	}
+	// Without MaxDelay the wait stops doubling before it overflows
+	limit := time.Duration(math.MaxInt64)
+	if p.MaxDelay > 0 {
+		limit = p.MaxDelay
+	}
+	for i := 1; i < attempt && d < limit; i++ {
+		if d > limit/2 {
+			d = limit
+			break
+		}
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * min(p.Jitter, 1) * float64(d))
+	}
+	return d
+}
+
+// clock tells the time and waits. Tests replace it so retries don't depend on the real time.
+type clock struct {
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+var systemClock = clock{now: time.Now, sleep: time.Sleep}
+
+// do calls send until it succeeds, fails permanently, or the policy runs out. It returns the number of attempts made.
+func (p *RetryPolicy) do(c clock, send func() error) (int, error) {
+	start := c.now()
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil || p == nil || attempt >= p.MaxAttempts || !IsTransient(err) {
+			return attempt, err
+		}
+
+		wait := p.delay(attempt)
+		if p.Deadline > 0 && wait >= p.Deadline-c.now().Sub(start) {
+			return attempt, err
+		}
+		c.sleep(wait)
+	}
+}
+
+// TransientError marks a delivery error as temporary so it can be retried.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// Transient wraps err so IsTransient reports true. Senders use it for failures that might succeed later, like a refused connection.
+// Permanent SMTP replies are still permanent when wrapped.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TransientError{Err: err}
+}
+
+// IsTransient reports whether a delivery error might succeed if retried.
+// SMTP 4xx replies such as 421, 450, 451 and 452 are transient and 5xx replies are permanent.
+// Timeouts, HTTP 429 and 5xx responses, and errors wrapped with Transient are also transient.
+func IsTransient(err error) bool {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code >= 400 && reply.Code < 500
+	}
+
+	var api *APIError
+	if errors.As(err, &api) {
+		return api.StatusCode == 429 || api.StatusCode >= 500
+	}
+
+	var transient *TransientError
+	if errors.As(err, &transient) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,172 @@
+package formailer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/textproto"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{errors.New("invalid address"), false},
+		{errors.New("Mail Error: No recipient specified"), false},
+		{fmt.Errorf("Mail Error on determining auth type, %s is not supported", "GSSAPI"), false},
+		{&textproto.Error{Code: 421, Msg: "service not available"}, true},
+		{&textproto.Error{Code: 450, Msg: "mailbox busy"}, true},
+		{fmt.Errorf("Mail Error on Auth: %w", &textproto.Error{Code: 451, Msg: "local error"}), true},
+		{&textproto.Error{Code: 452, Msg: "insufficient storage"}, true},
+		{&textproto.Error{Code: 550, Msg: "no such user"}, false},
+		{Transient(&textproto.Error{Code: 554, Msg: "rejected"}), false},
+		{Transient(errors.New("connection refused")), true},
+		{&net.OpError{Op: "dial", Err: timeoutError{}}, true},
+		{&APIError{StatusCode: 429}, true},
+		{&APIError{StatusCode: 503}, true},
+		{&APIError{StatusCode: 400}, false},
+	}
+
+	for _, test := range tests {
+		if IsTransient(test.err) != test.transient {
+			t.Errorf("Unexpected classification for %v \nExpected: %v; Got: %v", test.err, test.transient, !test.transient)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryDelay(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for attempt, expected := range []time.Duration{100, 200, 300, 300} {
+		if d := p.delay(attempt + 1); d != expected*time.Millisecond {
+			t.Errorf("Unexpected delay after attempt %d \nExpected: %v; Got: %v", attempt+1, expected*time.Millisecond, d)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if d := p.delay(1); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Errorf("Expected jitter to shorten the delay by at most half; Got: %v", d)
+		}
+	}
+
+	uncapped := &RetryPolicy{BaseDelay: time.Second}
+	if d := uncapped.delay(100); d != math.MaxInt64 {
+		t.Errorf("Expected an uncapped delay to stop growing before it overflows; Got: %v", d)
+	}
+}
+
+func TestRetrySMTP(t *testing.T) {
+	var rcpts int32
+	server := newFakeSMTP(t)
+	server.Reply = func(cmd string) string {
+		if cmd == "RCPT" && atomic.AddInt32(&rcpts, 1) < 3 {
+			return "451 4.3.0 Temporary failure, try again"
+		}
+		return ""
+	}
+	server.Setenv(t, "retry")
+	t.Setenv("SMTP_RETRY_AUTH", "none")
+
+	e := &Email{ID: "retry", To: "to@example.com", From: "forms@example.com", Retry: &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond}}
+	form := &Form{ID: "retry", Sender: SMTPSender{}}
+	form.AddEmail(*e)
+
+	s := &Submission{Form: form, Values: map[string]interface{}{}}
+	result := s.send(&form.Emails[0])
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Attempts != 3 || len(server.Messages()) != 1 {
+		t.Errorf("Expected delivery on the third attempt; Got: %d attempts and %d messages", result.Attempts, len(server.Messages()))
+	}
+
+	server.Reply = func(cmd string) string {
+		if cmd == "RCPT" {
+			return "550 5.1.1 No such user"
+		}
+		return ""
+	}
+	result = s.send(&form.Emails[0])
+	if result.Err == nil || result.Attempts != 1 {
+		t.Errorf("Expected permanent failure without retrying; Got: %d attempts %v", result.Attempts, result.Err)
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var waits []time.Duration
+	c := clock{
+		now:   func() time.Time { return now },
+		sleep: func(d time.Duration) { waits = append(waits, d); now = now.Add(d) },
+	}
+
+	p := &RetryPolicy{MaxAttempts: 10, BaseDelay: 40 * time.Millisecond, Deadline: 100 * time.Millisecond}
+	attempts, err := p.do(c, func() error {
+		// Every attempt takes 10ms
+		now = now.Add(10 * time.Millisecond)
+		return Transient(errors.New("connection refused"))
+	})
+
+	// Attempts end at 10ms and 60ms, waiting 80ms more would pass the deadline
+	if err == nil || attempts != 2 || !cmp.Equal(waits, []time.Duration{40 * time.Millisecond}) {
+		t.Errorf("Expected the deadline to stop retries \nExpected: 2 attempts waiting [40ms]; Got: %d waiting %v %v", attempts, waits, err)
+	}
+}
+
+func TestSMTPTransient(t *testing.T) {
+	// Nothing is listening so the connection is refused
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+
+	t.Setenv("SMTP_REFUSED_HOST", host)
+	t.Setenv("SMTP_REFUSED_PORT", port)
+	t.Setenv("SMTP_REFUSED_ENCRYPTION", "none")
+	t.Setenv("SMTP_REFUSED_AUTH", "none")
+
+	server := newFakeSMTP(t)
+	server.Reply = func(cmd string) string {
+		if cmd == "DATA" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return ""
+	}
+	server.Setenv(t, "slow")
+	t.Setenv("SMTP_SLOW_AUTH", "none")
+	t.Setenv("SMTP_SLOW_SEND_TIMEOUT", "50ms")
+
+	form := &Form{ID: "transient", Sender: SMTPSender{}}
+	retry := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	form.AddEmail(
+		Email{ID: "refused", To: "to@example.com", From: "forms@example.com", Retry: retry},
+		Email{ID: "slow", To: "to@example.com", From: "forms@example.com", Retry: retry},
+	)
+	s := &Submission{Form: form, Values: map[string]interface{}{}}
+
+	result := s.send(&form.Emails[0])
+	if !IsTransient(result.Err) || result.Attempts != 3 {
+		t.Errorf("Expected a refused connection to be retried; Got: %d attempts %v", result.Attempts, result.Err)
+	}
+
+	// The server could still accept the message so a send timeout isn't retried
+	result = s.send(&form.Emails[1])
+	if result.Err == nil || IsTransient(result.Err) || result.Attempts != 1 {
+		t.Errorf("Expected a send timeout not to be retried; Got: %d attempts %v", result.Attempts, result.Err)
+	}
+}
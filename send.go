@@ -0,0 +1,175 @@
+package formailer
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SendResult describes the delivery of a single email.
+type SendResult struct {
+	// ID is the Email.ID of the email.
+	ID string
+
+	// To is the address the email was sent to, empty when it couldn't be rendered.
+	To string
+
+	// AutoReply is true for the submitter's confirmation email.
+	AutoReply bool
+
+	// Err is nil when the email was delivered.
+	Err error
+
+	// Attempts is how many times sending was tried. It is more than one when Email.Retry retried a transient failure.
+	Attempts int
+
+	// Duration is how long generating and sending the email took, including any retries.
+	Duration time.Duration
+}
+
+// name identifies the result in error messages
+func (r SendResult) name() string {
+	if r.AutoReply {
+		return or(r.ID, "auto-reply")
+	}
+	return or(r.ID, r.To)
+}
+
+// SendError is returned by Submission.Send when any email fails.
+// It has the result of every selected email so callers can tell which were delivered.
+type SendError struct {
+	Results []SendResult
+}
+
+func (e *SendError) Error() string {
+	failed := e.Failed()
+	messages := make([]string, len(failed))
+	for i, r := range failed {
+		messages[i] = r.name() + ": " + r.Err.Error()
+	}
+	return fmt.Sprintf("%d of %d emails failed: %s", len(failed), len(e.Results), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the error of every failed email so errors.Is and errors.As check each of them.
+func (e *SendError) Unwrap() []error {
+	var errs []error
+	for _, r := range e.Failed() {
+		errs = append(errs, r.Err)
+	}
+	return errs
+}
+
+// Failed returns the results of the emails that weren't delivered.
+func (e *SendError) Failed() []SendResult {
+	var results []SendResult
+	for _, r := range e.Results {
+		if r.Err != nil {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// Delivered returns the results of the emails that were delivered.
+func (e *SendError) Delivered() []SendResult {
+	var results []SendResult
+	for _, r := range e.Results {
+		if r.Err == nil {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// recipient renders the address e is sent to, or an empty string when it can't be rendered
+func (s *Submission) recipient(e *Email) string {
+	to, err := renderAddress("To", e.To, s)
+	if err != nil {
+		return ""
+	}
+	addr, err := mail.ParseAddress(to)
+	if err != nil {
+		return ""
+	}
+	return addr.Address
+}
+
+// delivered reports whether e was delivered by an earlier attempt at sending the submission, as recorded by Record.Delivered
+func (s *Submission) delivered(e *Email, autoReply bool) bool {
+	if len(s.skip) < 1 {
+		return false
+	}
+	return s.skip[SendResult{ID: e.ID, To: s.recipient(e), AutoReply: autoReply}.name()]
+}
+
+// send generates and sends a single email timing how long it takes
+func (s *Submission) send(e *Email) SendResult {
+	start := time.Now()
+	result := SendResult{ID: e.ID, To: s.recipient(e)}
+
+	email, err := e.Email(s)
+	if err == nil {
+		result.Attempts, err = e.Retry.do(systemClock, func() error {
+			return e.SendForm(s.Form, email)
+		})
+	}
+
+	result.Err = err
+	result.Duration = time.Since(start)
+	return result
+}
+
+// sendAll sends the emails using up to Form.Concurrency goroutines. Results are in the same order as emails.
+func (s *Submission) sendAll(emails []Email) []SendResult {
+	results := make([]SendResult, len(emails))
+	limit := s.Form.Concurrency
+	if limit < 1 {
+		limit = 1
+	}
+
+	if limit == 1 {
+		for i := range emails {
+			results[i] = s.send(&emails[i])
+		}
+		return results
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for i := range emails {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.send(&emails[i])
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// autoReply sends the auto-reply returning nil when it is skipped
+func (s *Submission) autoReply() *SendResult {
+	if s.Form.AutoReply == nil {
+		return nil
+	}
+	e := s.Form.AutoReply.email(s)
+	if e == nil {
+		return nil
+	}
+
+	ok, err := e.Condition.Match(s)
+	if err != nil {
+		return &SendResult{ID: e.ID, AutoReply: true, Err: fmt.Errorf("failed to check auto-reply condition: %w", err)}
+	}
+	if !ok || s.delivered(e, true) {
+		return nil
+	}
+
+	result := s.send(e)
+	result.AutoReply = true
+	return &result
+}
@@ -0,0 +1,94 @@
+package formailer
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+func TestSendPartialFailure(t *testing.T) {
+	fail := errors.New("mailbox unavailable")
+	var mu sync.Mutex
+	var sent []string
+	form := &Form{ID: "partial", Sender: SenderFunc(func(e *Email, email *mail.Email) error {
+		if e.ID == "second" {
+			return fail
+		}
+		mu.Lock()
+		sent = append(sent, e.ID)
+		mu.Unlock()
+		return nil
+	})}
+	form.AddEmail(
+		Email{ID: "first", To: "first@example.com", From: "b@example.com"},
+		Email{ID: "second", To: "second@example.com", From: "b@example.com"},
+		Email{ID: "third", To: "third@example.com", From: "b@example.com"},
+	)
+	form.AutoReply = &AutoReply{Field: "email", Email: Email{ID: "reply", From: "b@example.com"}}
+
+	s := &Submission{Form: form, Values: map[string]interface{}{"email": "person@example.com"}}
+	err := s.Send()
+
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) {
+		t.Fatalf("Expected a SendError; Got: %v", err)
+	}
+	if !errors.Is(err, fail) {
+		t.Error("Expected SendError to unwrap the sender error")
+	}
+	if strings.Join(sent, ",") != "first,third" {
+		t.Errorf("Expected every other email to be sent without the auto-reply \nExpected: first,third; Got: %v", sent)
+	}
+	if len(sendErr.Results) != 3 || len(sendErr.Delivered()) != 2 || len(sendErr.Failed()) != 1 {
+		t.Fatalf("Unexpected results: %+v", sendErr.Results)
+	}
+
+	failed := sendErr.Failed()[0]
+	if failed.ID != "second" || failed.To != "second@example.com" || failed.Duration <= 0 {
+		t.Errorf("Unexpected failed result: %+v", failed)
+	}
+	if err.Error() != "1 of 3 emails failed: second: mailbox unavailable" {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+}
+
+func TestSendConcurrency(t *testing.T) {
+	var running, peak int32
+	form := &Form{ID: "concurrent", Concurrency: 2, Sender: SenderFunc(func(e *Email, email *mail.Email) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		if e.ID == "4" {
+			return errors.New("failed")
+		}
+		return nil
+	})}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		form.AddEmail(Email{ID: id, To: "to@example.com", From: "b@example.com"})
+	}
+
+	err := (&Submission{Form: form, Values: map[string]interface{}{}}).Send()
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) {
+		t.Fatalf("Expected a SendError; Got: %v", err)
+	}
+	if peak != 2 {
+		t.Errorf("Unexpected concurrency \nExpected: 2; Got: %d", peak)
+	}
+	for i, r := range sendErr.Results {
+		if r.ID != form.Emails[i].ID {
+			t.Errorf("Expected results in order \nExpected: %s; Got: %s", form.Emails[i].ID, r.ID)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package formailer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// Sender delivers a generated email. Implementations can send over SMTP, post to an HTTP API, write to disk, or push to a queue.
+type Sender interface {
+	Send(e *Email, email *mail.Email) error
+}
+
+// SenderFunc is an adapter to allow the use of ordinary functions as a Sender.
+type SenderFunc func(e *Email, email *mail.Email) error
+
+// Send calls f(e, email).
+func (f SenderFunc) Send(e *Email, email *mail.Email) error {
+	return f(e, email)
+}
+
+// SMTPSender sends emails over SMTP using the settings stored in the environment. See Email.ID for how settings are looked up.
+// Setting SMTP_AUTH to xoauth2 authenticates with an OAuth2 access token obtained from SMTP_OAUTH_REFRESH_TOKEN.
+type SMTPSender struct{}
+
+// Send connects to the SMTP server configured for e and sends the email.
+func (SMTPSender) Send(e *Email, email *mail.Email) error {
+	server, err := e.server()
+	if err != nil {
+		return err
+	}
+	if email.GetError() != nil {
+		return email.GetError()
+	}
+	if e.usesXOAUTH2() {
+		return sendXOAUTH2(e, server, email)
+	}
+
+	conn, err := dialSMTP(server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// go-simple-mail gives up waiting on a send that keeps running in the background, which could deliver after a retry.
+	// The timeouts are enforced with deadlines on the connection instead.
+	connectTimeout, sendTimeout := server.ConnectTimeout, server.SendTimeout
+	server.CustomConn = conn
+	server.ConnectTimeout, server.SendTimeout = 0, 0
+
+	setDeadline(conn, connectTimeout)
+	client, err := server.Connect()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	setDeadline(conn, sendTimeout)
+	if err := sendTimedOut(email.Send(client)); err != nil {
+		return err
+	}
+	client.Quit()
+	return nil
+}
+
+// dialSMTP connects to the server completing the TLS handshake for implicit TLS.
+// Network failures are transient while handshake failures like an invalid certificate won't be fixed by retrying.
+func dialSMTP(server *mail.SMTPServer) (net.Conn, error) {
+	addr := net.JoinHostPort(server.Host, strconv.Itoa(server.Port))
+	dialer := &net.Dialer{Timeout: server.ConnectTimeout}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, Transient(fmt.Errorf("failed to connect to %s: %w", addr, err))
+	}
+	if server.Encryption != mail.EncryptionSSL && server.Encryption != mail.EncryptionSSLTLS {
+		return conn, nil
+	}
+
+	tlsConfig := server.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: server.Host}
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	setDeadline(tlsConn, server.ConnectTimeout)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		err = fmt.Errorf("TLS handshake with %s failed: %w", addr, err)
+		var netErr net.Error
+		if errors.As(err, &netErr) {
+			return nil, Transient(err)
+		}
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// setDeadline limits the time left for reading and writing, a zero timeout removes the limit
+func setDeadline(conn net.Conn, timeout time.Duration) {
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	} else {
+		conn.SetDeadline(time.Time{})
+	}
+}
+
+// sendTimedOut makes a timeout while sending permanent since the server may already have accepted the message
+func sendTimedOut(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("SMTP send timed out, the email may have been delivered: %v", err)
+	}
+	return err
+}
+
+// DefaultSender is used when neither the Email, its Form nor the Form's Config have a Sender set.
+var DefaultSender Sender = SMTPSender{}
+
+// SetSender sets the sender used by forms in the config that don't have their own. Setting it to nil falls back on DefaultSender again.
+// Forms added later get the same sender as long as the config already had forms when SetSender was called.
+func (c Config) SetSender(s Sender) {
+	for _, form := range c {
+		form.configSender = s
+	}
+}
+
+// SetSender sets the sender on the default config.
+func SetSender(s Sender) {
+	DefaultConfig.SetSender(s)
+}
+
+// sender picks the most specific sender for e, falling back on the form, the config the form was added to and then DefaultSender.
+func sender(f *Form, e *Email) Sender {
+	if e.Sender != nil {
+		return e.Sender
+	}
+	if f != nil && f.Sender != nil {
+		return f.Sender
+	}
+	if f != nil && f.configSender != nil {
+		return f.configSender
+	}
+	return DefaultSender
+}
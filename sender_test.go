@@ -0,0 +1,89 @@
+package formailer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+func TestSenderFallback(t *testing.T) {
+	var sent []string
+	record := func(name string) Sender {
+		return SenderFunc(func(e *Email, email *mail.Email) error {
+			sent = append(sent, name+":"+e.ID)
+			return nil
+		})
+	}
+
+	form := &Form{ID: "sender", Sender: record("form")}
+	form.AddEmail(
+		Email{ID: "first", To: "a@example.com", From: "b@example.com"},
+		Email{ID: "second", To: "a@example.com", From: "b@example.com", Sender: record("email")},
+	)
+
+	submission := &Submission{Form: form, Values: map[string]interface{}{}}
+	if err := submission.Send(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"form:first", "email:second"}
+	if len(sent) != len(expected) {
+		t.Fatalf("Unexpected sends\nExpected: %v; Got: %v", expected, sent)
+	}
+	for i := range expected {
+		if sent[i] != expected[i] {
+			t.Errorf("Unexpected sender used\nExpected: %s; Got: %s", expected[i], sent[i])
+		}
+	}
+}
+
+func TestSenderError(t *testing.T) {
+	fail := errors.New("delivery failed")
+	form := &Form{ID: "sender", Sender: SenderFunc(func(*Email, *mail.Email) error { return fail })}
+	form.AddEmail(Email{To: "a@example.com", From: "b@example.com"})
+
+	submission := &Submission{Form: form, Values: map[string]interface{}{}}
+	if err := submission.Send(); !errors.Is(err, fail) {
+		t.Errorf("Expected sender error; Got: %v", err)
+	}
+}
+
+func TestConfigSetSender(t *testing.T) {
+	var sent []string
+	record := func(name string) Sender {
+		return SenderFunc(func(e *Email, email *mail.Email) error {
+			sent = append(sent, name+":"+e.ID)
+			return nil
+		})
+	}
+
+	c := make(Config)
+	c.Add(&Form{ID: "a"}, &Form{ID: "b", Sender: record("form")})
+	c.SetSender(record("config"))
+	c.Add(&Form{ID: "later"})
+
+	for _, id := range []string{"a", "b", "later"} {
+		c[id].AddEmail(Email{ID: id, To: "a@example.com", From: "b@example.com"})
+		submission := &Submission{Form: c[id], Values: map[string]interface{}{}}
+		if err := submission.Send(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := &c["a"].Emails[0]
+	if err := e.SendForm(c["b"], mail.NewMSG()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"config:a", "form:b", "config:later", "form:a"}
+	if !cmp.Equal(sent, expected) {
+		t.Errorf("Unexpected senders used\nExpected: %v; Got: %v", expected, sent)
+	}
+
+	c.SetSender(nil)
+	if s := sender(c["a"], e); s != DefaultSender {
+		t.Errorf("Expected DefaultSender once the config sender is cleared; Got: %v", s)
+	}
+}
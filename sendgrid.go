@@ -0,0 +1,113 @@
+package formailer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	simplemail "github.com/xhit/go-simple-mail/v2"
+)
+
+// SendGridSender sends emails using the SendGrid v3 mail send API.
+// The API key is read from SENDGRID_<ID>_API_KEY falling back on SENDGRID_API_KEY.
+type SendGridSender struct {
+	// BaseURL defaults to https://api.sendgrid.com.
+	BaseURL string
+
+	// Client is used to make requests, when nil apiClient is used.
+	Client *http.Client
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Filename    string `json:"filename"`
+	Type        string `json:"type,omitempty"`
+	Disposition string `json:"disposition"`
+}
+
+type sendGridPersonalization struct {
+	To  []sendGridAddress `json:"to"`
+	Cc  []sendGridAddress `json:"cc,omitempty"`
+	Bcc []sendGridAddress `json:"bcc,omitempty"`
+}
+
+type sendGridMessage struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	ReplyTo          *sendGridAddress          `json:"reply_to,omitempty"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+	Categories       []string                  `json:"categories,omitempty"`
+}
+
+func sendGridAddresses(list []*mail.Address) []sendGridAddress {
+	addrs := make([]sendGridAddress, len(list))
+	for i, a := range list {
+		addrs[i] = sendGridAddress{Email: a.Address, Name: a.Name}
+	}
+	return addrs
+}
+
+// Send posts the email to the SendGrid API.
+func (s SendGridSender) Send(e *Email, email *simplemail.Email) error {
+	key, err := e.requireEnv("SendGrid", "SENDGRID", "API_KEY")
+	if err != nil {
+		return err
+	}
+
+	m, err := parseMessage(email)
+	if err != nil {
+		return err
+	}
+
+	body := sendGridMessage{
+		Personalizations: []sendGridPersonalization{{
+			To:  sendGridAddresses(m.To),
+			Cc:  sendGridAddresses(m.Cc),
+			Bcc: sendGridAddresses(m.Bcc),
+		}},
+		From:       sendGridAddress{Email: m.From.Address, Name: m.From.Name},
+		Subject:    m.Subject,
+		Headers:    m.Headers,
+		Categories: e.tags(),
+	}
+	if len(m.ReplyTo) > 0 {
+		body.ReplyTo = &sendGridAddresses(m.ReplyTo)[0]
+	}
+	if len(m.Text) > 0 {
+		body.Content = append(body.Content, sendGridContent{Type: "text/plain", Value: m.Text})
+	}
+	if len(m.HTML) > 0 {
+		body.Content = append(body.Content, sendGridContent{Type: "text/html", Value: m.HTML})
+	}
+	for _, a := range m.Attachments {
+		body.Attachments = append(body.Attachments, sendGridAttachment{
+			Content:     base64.StdEncoding.EncodeToString(a.Data),
+			Filename:    a.Filename,
+			Type:        a.MimeType,
+			Disposition: "attachment",
+		})
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(or(s.BaseURL, "https://api.sendgrid.com"), "/") + "/v3/mail/send"
+	return post(s.Client, url, "application/json", b, map[string]string{"Authorization": "Bearer " + key})
+}
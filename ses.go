@@ -0,0 +1,141 @@
+package formailer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	simplemail "github.com/xhit/go-simple-mail/v2"
+)
+
+// SESSender sends emails using the Amazon SES v2 API as raw MIME messages.
+// Settings are read from SES_<ID>_<KEY> falling back on SES_<KEY> and then the standard AWS_<KEY> variables
+// for REGION, ACCESS_KEY_ID, SECRET_ACCESS_KEY and SESSION_TOKEN.
+type SESSender struct {
+	// BaseURL defaults to https://email.<region>.amazonaws.com.
+	BaseURL string
+
+	// Client is used to make requests, when nil apiClient is used.
+	Client *http.Client
+}
+
+type sesMessage struct {
+	FromEmailAddress string
+	Destination      struct {
+		ToAddresses []string
+	}
+	Content struct {
+		Raw struct {
+			Data []byte
+		}
+	}
+}
+
+// sesEnv looks up an SES setting falling back on the standard AWS variable
+func (e *Email) sesEnv(key string) string {
+	return or(e.env("SES", key), os.Getenv("AWS_"+key))
+}
+
+// Send posts the email to the SES API.
+func (s SESSender) Send(e *Email, email *simplemail.Email) error {
+	region := e.sesEnv("REGION")
+	accessKey := e.sesEnv("ACCESS_KEY_ID")
+	secretKey := e.sesEnv("SECRET_ACCESS_KEY")
+	settings := [][2]string{{"REGION", region}, {"ACCESS_KEY_ID", accessKey}, {"SECRET_ACCESS_KEY", secretKey}}
+	for _, setting := range settings {
+		if key := setting[0]; len(setting[1]) < 1 {
+			return fmt.Errorf("incomplete SES configuration missing SES_%s_%s, SES_%s or AWS_%s for %s", strings.ToUpper(e.ID), key, key, key, e.ID)
+		}
+	}
+	if email.GetError() != nil {
+		return email.GetError()
+	}
+
+	var body sesMessage
+	body.FromEmailAddress = email.GetFrom()
+	body.Destination.ToAddresses = email.GetRecipients()
+	body.Content.Raw.Data = []byte(rawMessage(email))
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(or(s.BaseURL, "https://email."+region+".amazonaws.com"), "/") + "/v2/email/outbound-emails"
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := e.sesEnv("SESSION_TOKEN"); len(token) > 0 {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	signV4(req, b, time.Now().UTC(), region, "ses", accessKey, secretKey)
+
+	return do(s.Client, req)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signV4 signs the request using AWS Signature Version 4
+func signV4(req *http.Request, body []byte, t time.Time, region, service, accessKey, secretKey string) {
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(req.Header.Get(key))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		or(req.URL.EscapedPath(), "/"),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
@@ -0,0 +1,164 @@
+package formailer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSMTP is a minimal SMTP server for testing delivery without a real mail server
+type fakeSMTP struct {
+	Host string
+	Port string
+
+	// Reply can override the reply to any command. Returning an empty string uses the default reply.
+	Reply func(cmd string) string
+
+	mu       sync.Mutex
+	messages []fakeMessage
+	auths    []string
+	listener net.Listener
+}
+
+type fakeMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	s := &fakeSMTP{Host: host, Port: port, listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// Setenv points the SMTP settings for id at the fake server
+func (s *fakeSMTP) Setenv(t *testing.T, id string) {
+	prefix := "SMTP_" + strings.ToUpper(id) + "_"
+	t.Setenv(prefix+"HOST", s.Host)
+	t.Setenv(prefix+"PORT", s.Port)
+	t.Setenv(prefix+"ENCRYPTION", "none")
+}
+
+func (s *fakeSMTP) Messages() []fakeMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeMessage(nil), s.messages...)
+}
+
+func (s *fakeSMTP) Auths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.auths...)
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	reply := func(lines ...string) {
+		for _, line := range lines {
+			w.WriteString(line + "\r\n")
+		}
+		w.Flush()
+	}
+
+	var msg fakeMessage
+	reply("220 localhost fake SMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		if s.Reply != nil {
+			if custom := s.Reply(cmd); len(custom) > 0 {
+				reply(custom)
+				if strings.HasPrefix(custom, "421") {
+					return
+				}
+				continue
+			}
+		}
+
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250-localhost", "250-AUTH PLAIN LOGIN XOAUTH2", "250 8BITMIME")
+		case "AUTH":
+			fields := strings.Fields(line)
+			if len(fields) > 2 {
+				decoded, _ := base64.StdEncoding.DecodeString(fields[2])
+				s.mu.Lock()
+				s.auths = append(s.auths, fields[1]+" "+string(decoded))
+				s.mu.Unlock()
+			}
+			reply("235 2.7.0 Accepted")
+		case "MAIL":
+			msg = fakeMessage{From: envelopeAddress(line)}
+			reply("250 2.1.0 OK")
+		case "RCPT":
+			msg.To = append(msg.To, envelopeAddress(line))
+			reply("250 2.1.5 OK")
+		case "DATA":
+			reply("354 Go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 2.0.0 OK queued as " + strconv.Itoa(len(s.Messages())))
+		case "RSET":
+			msg = fakeMessage{}
+			reply("250 OK")
+		case "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// envelopeAddress extracts the address from MAIL FROM:<a> and RCPT TO:<a>
+func envelopeAddress(line string) string {
+	start := strings.Index(line, "<")
+	end := strings.Index(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
@@ -0,0 +1,172 @@
+package formailer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Status is the delivery status of a stored submission.
+type Status string
+
+// Statuses for Record.Status.
+const (
+	StatusFailed Status = "failed"
+	StatusSent   Status = "sent"
+)
+
+// Record is a submission saved in a Store so it can be replayed after a failure.
+// Attachments are stored with their data so replayed emails are complete.
+type Record struct {
+	// ID is the Submission.ID.
+	ID string `json:"id"`
+
+	// Form is the ID of the form the submission was sent to.
+	Form string `json:"form"`
+
+	Order       []string               `json:"order"`
+	Values      map[string]interface{} `json:"values"`
+	Attachments []Attachment           `json:"attachments,omitempty"`
+	Spam        bool                   `json:"spam,omitempty"`
+
+	// Status is StatusFailed until the submission is sent.
+	Status Status `json:"status"`
+
+	// Error is the last send error.
+	Error string `json:"error,omitempty"`
+
+	// Attempts counts how many times the submission has been sent, including replays.
+	Attempts int `json:"attempts"`
+
+	// Delivered lists the emails that were sent before the submission failed, by Email.ID or recipient.
+	// Replay doesn't send them again.
+	Delivered []string `json:"delivered,omitempty"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// NewRecord creates a record for a submission after sending it. err is the error returned by Submission.Send.
+// It fails when an attachment can't be read since the record couldn't be replayed without it.
+func NewRecord(s *Submission, err error) (*Record, error) {
+	now := time.Now().UTC()
+	r := &Record{
+		ID:       s.ID,
+		Order:    s.Order,
+		Values:   s.Values,
+		Spam:     s.Spam,
+		Status:   StatusSent,
+		Attempts: 1,
+		Created:  now,
+		Updated:  now,
+	}
+	if s.Form != nil {
+		r.Form = strings.ToLower(or(s.Form.ID, s.Form.Name))
+	}
+
+	// Temporary files are removed after the request so large attachments are read into the record
+	for _, a := range s.Attachments {
+		data, err := a.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment %s: %w", a.Filename, err)
+		}
+		a.Data, a.Path = data, ""
+		r.Attachments = append(r.Attachments, a)
+	}
+	if err != nil {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+		r.addDelivered(err)
+	}
+	return r, nil
+}
+
+// addDelivered adds the emails delivered before err to Delivered
+func (r *Record) addDelivered(err error) {
+	var failed *SendError
+	if !errors.As(err, &failed) {
+		return
+	}
+	for _, result := range failed.Delivered() {
+		r.Delivered = append(r.Delivered, result.name())
+	}
+}
+
+// Submission rebuilds the submission using the form from the config. Sending it leaves out the emails in Delivered.
+func (r *Record) Submission(c Config) (*Submission, error) {
+	form, ok := c[r.Form]
+	if !ok {
+		return nil, fmt.Errorf("missing form config for form %s", r.Form)
+	}
+
+	s := &Submission{
+		ID:          r.ID,
+		Form:        form,
+		Order:       r.Order,
+		Values:      r.Values,
+		Attachments: r.Attachments,
+		Spam:        r.Spam,
+		skip:        make(map[string]bool),
+	}
+	for _, name := range r.Delivered {
+		s.skip[name] = true
+	}
+	return s, nil
+}
+
+// Store persists submissions so ones that failed to send aren't lost.
+// FileStore and SQLiteStore are built in. Implementations must be safe for concurrent use.
+type Store interface {
+	// Save inserts the record or replaces the record with the same ID.
+	Save(r *Record) error
+
+	// List returns the records with the status, or every record when status is empty, oldest first.
+	List(status Status) ([]*Record, error)
+
+	// Delete removes the record with the ID. Deleting a missing record isn't an error.
+	Delete(id string) error
+}
+
+// Replay resends every failed submission in the store using the forms in the config.
+// Emails that were delivered before the submission failed, including the auto-reply, aren't sent again.
+// Records are updated with the result so a submission isn't replayed once sent. It returns how many submissions were sent.
+func (c Config) Replay(store Store) (int, error) {
+	records, err := store.List(StatusFailed)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []error
+	for _, r := range records {
+		s, err := r.Submission(c)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to replay %s: %w", r.ID, err))
+			continue
+		}
+
+		err = s.Send()
+		r.Attempts++
+		r.Updated = time.Now().UTC()
+		if err != nil {
+			r.Error = err.Error()
+			r.addDelivered(err)
+			errs = append(errs, fmt.Errorf("failed to replay %s: %w", r.ID, err))
+		} else {
+			r.Status, r.Error = StatusSent, ""
+			sent++
+		}
+
+		if err := store.Save(r); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save %s: %w", r.ID, err))
+		}
+	}
+
+	return sent, errors.Join(errs...)
+}
+
+// Replay resends the failed submissions in the store using the default config.
+func Replay(store Store) (int, error) {
+	return DefaultConfig.Replay(store)
+}
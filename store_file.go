@@ -0,0 +1,190 @@
+package formailer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileStore saves records as JSON lines appended to a file. The latest line for an ID replaces earlier ones.
+// Call Compact now and then to drop replaced and deleted records.
+// On serverless platforms the filesystem, including /tmp, is thrown away with the instance so use a mounted volume or SQLiteStore on durable storage.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// fileLine is a line in a FileStore, either a record or the ID of a deleted record
+type fileLine struct {
+	*Record
+	Deleted string `json:"deleted,omitempty"`
+}
+
+// NewFileStore creates a store using the file at path. The file and its directory are created on the first save.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Save appends the record to the file.
+func (f *FileStore) Save(r *Record) error {
+	if len(r.ID) < 1 {
+		return errors.New("record is missing id")
+	}
+	return f.append(fileLine{Record: r})
+}
+
+// Delete appends a line marking the record as deleted.
+func (f *FileStore) Delete(id string) error {
+	return f.append(fileLine{Deleted: id})
+}
+
+// List reads the file returning the latest version of each record.
+func (f *FileStore) List(status Status) ([]*Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*Record
+	for _, r := range records {
+		if len(status) < 1 || r.Status == status {
+			list = append(list, r)
+		}
+	}
+	return list, nil
+}
+
+// Compact rewrites the file with only the latest version of each record.
+func (f *FileStore) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to compact store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(fileLine{Record: r}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to compact store: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to compact store: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to compact store: %w", err)
+	}
+	return nil
+}
+
+// append writes a single line syncing it to disk before returning
+func (f *FileStore) append(line fileLine) error {
+	b, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open store: %w", err)
+	}
+
+	// Start a new line if a partial line was left by a crash so this record isn't lost with it
+	b = append(b, '\n')
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			b = append([]byte{'\n'}, b...)
+		}
+	}
+
+	_, err = file.Write(b)
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	return nil
+}
+
+// read returns the latest version of every record ordered by creation time
+func (f *FileStore) read() ([]*Record, error) {
+	file, err := os.Open(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+	defer file.Close()
+
+	latest := make(map[string]*Record)
+	reader := bufio.NewReader(file)
+	for {
+		b, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read store: %w", err)
+		}
+
+		var line fileLine
+		// A crash while appending can leave a partial line which is skipped
+		if len(b) > 0 && json.Unmarshal(b, &line) == nil {
+			if len(line.Deleted) > 0 {
+				delete(latest, line.Deleted)
+			} else if line.Record != nil {
+				latest[line.ID] = line.Record
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	records := make([]*Record, 0, len(latest))
+	for _, r := range latest {
+		records = append(records, r)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Created.Equal(records[j].Created) {
+			return records[i].ID < records[j].ID
+		}
+		return records[i].Created.Before(records[j].Created)
+	})
+	return records, nil
+}
@@ -0,0 +1,92 @@
+package formailer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SQLiteStore saves records in an SQLite table named formailer_submissions.
+// Formailer doesn't import a driver so open db with the one you prefer, like github.com/mattn/go-sqlite3 or modernc.org/sqlite.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// sqliteSchema is run statement by statement as not every driver supports several in one Exec
+var sqliteSchema = []string{`CREATE TABLE IF NOT EXISTS formailer_submissions (
+	id TEXT PRIMARY KEY,
+	form TEXT NOT NULL,
+	status TEXT NOT NULL,
+	record TEXT NOT NULL,
+	created TEXT NOT NULL,
+	updated TEXT NOT NULL
+)`,
+	`CREATE INDEX IF NOT EXISTS formailer_submissions_status ON formailer_submissions (status, created)`,
+}
+
+// NewSQLiteStore creates the formailer_submissions table if it doesn't exist and returns a store using it.
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	for _, stmt := range sqliteSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("failed to create submissions table: %w", err)
+		}
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Save inserts the record or replaces the one with the same ID.
+func (s *SQLiteStore) Save(r *Record) error {
+	if len(r.ID) < 1 {
+		return errors.New("record is missing id")
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	_, err = s.db.Exec(`INSERT INTO formailer_submissions (id, form, status, record, created, updated) VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET form = excluded.form, status = excluded.status, record = excluded.record, updated = excluded.updated`,
+		r.ID, r.Form, string(r.Status), string(b), r.Created.UTC().Format(time.RFC3339Nano), r.Updated.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("failed to save record: %w", err)
+	}
+	return nil
+}
+
+// List returns the records with the status, or every record when status is empty, oldest first.
+func (s *SQLiteStore) List(status Status) ([]*Record, error) {
+	rows, err := s.db.Query(`SELECT record FROM formailer_submissions WHERE ? = '' OR status = ? ORDER BY created, id`, string(status), string(status))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*Record
+	for rows.Next() {
+		var b string
+		if err := rows.Scan(&b); err != nil {
+			return nil, fmt.Errorf("failed to list records: %w", err)
+		}
+
+		r := new(Record)
+		if err := json.Unmarshal([]byte(b), r); err != nil {
+			return nil, fmt.Errorf("failed to decode record: %w", err)
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list records: %w", err)
+	}
+	return records, nil
+}
+
+// Delete removes the record with the ID.
+func (s *SQLiteStore) Delete(id string) error {
+	if _, err := s.db.Exec(`DELETE FROM formailer_submissions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete record: %w", err)
+	}
+	return nil
+}
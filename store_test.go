@@ -0,0 +1,304 @@
+package formailer
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	mail "github.com/xhit/go-simple-mail/v2"
+	_ "modernc.org/sqlite"
+)
+
+func testRecord(id string, status Status, created time.Time) *Record {
+	return &Record{
+		ID:          id,
+		Form:        "contact",
+		Order:       []string{"email"},
+		Values:      map[string]interface{}{"_form_name": "contact", "email": "person@example.com"},
+		Attachments: []Attachment{{Filename: "cv.pdf", MimeType: "application/pdf", Data: []byte("%PDF-1.4")}},
+		Status:      status,
+		Attempts:    1,
+		Created:     created,
+		Updated:     created,
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	now := time.Now().UTC().Truncate(time.Second)
+	first := testRecord("first", StatusFailed, now)
+	second := testRecord("second", StatusSent, now.Add(time.Second))
+	third := testRecord("third", StatusFailed, now.Add(2*time.Second))
+
+	for _, r := range []*Record{third, first, second} {
+		if err := store.Save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := store.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*Record{first, second, third}, records); len(diff) > 0 {
+		t.Errorf("Unexpected records (-want +got):\n%s", diff)
+	}
+
+	first.Status, first.Attempts = StatusSent, 2
+	if err := store.Save(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("third"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("missing"); err != nil {
+		t.Errorf("Expected deleting a missing record to succeed; Got: %v", err)
+	}
+
+	records, err = store.List(StatusSent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*Record{first, second}, records); len(diff) > 0 {
+		t.Errorf("Unexpected records after update (-want +got):\n%s", diff)
+	}
+
+	records, err = store.List(StatusFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) > 0 {
+		t.Errorf("Expected no failed records; Got: %+v", records)
+	}
+
+	if err := store.Save(&Record{}); err == nil {
+		t.Error("Expected an error saving a record without an id")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox", "submissions.jsonl")
+	store := NewFileStore(path)
+
+	records, err := store.List("")
+	if err != nil || len(records) > 0 {
+		t.Fatalf("Expected a missing file to be empty; Got: %v %v", records, err)
+	}
+
+	testStore(t, store)
+
+	// Simulate a crash part way through a write
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"id":"partial","form":"con`)
+	file.Close()
+
+	late := testRecord("late", StatusFailed, time.Now().UTC().Add(time.Minute))
+	if err := store.Save(late); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err = store.List(StatusFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != "late" {
+		t.Errorf("Expected the partial line to be skipped; Got: %+v", records)
+	}
+
+	before, _ := store.List("")
+	if err := store.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := store.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(before, after); len(diff) > 0 {
+		t.Errorf("Unexpected records after compacting (-want +got):\n%s", diff)
+	}
+
+	b, _ := os.ReadFile(path)
+	if lines := bytes.Count(b, []byte("\n")); lines != len(after) {
+		t.Errorf("Expected compacted file to have %d lines; Got: %d", len(after), lines)
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "formailer.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSQLiteStore(db); err != nil {
+		t.Errorf("Expected creating the table twice to succeed; Got: %v", err)
+	}
+
+	testStore(t, store)
+}
+
+func TestNewRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload")
+	if err := os.WriteFile(path, []byte("large upload"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := &Submission{ID: "upload", Form: &Form{ID: "Contact"}, Attachments: []Attachment{{Field: "cv", Filename: "cv.txt", MimeType: "text/plain", Path: path}}}
+
+	record, err := NewRecord(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(record.Attachments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"field":"cv","filename":"cv.txt","mime_type":"text/plain","data":"bGFyZ2UgdXBsb2Fk"}]`
+	if string(b) != expected {
+		t.Errorf("Unexpected stored attachments\nExpected: %s\nGot: %s", expected, b)
+	}
+
+	os.Remove(path)
+	if _, err := NewRecord(s, nil); err == nil {
+		t.Error("Expected an error when an attachment can't be read")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	down := true
+	var sent []*mail.Email
+	form := &Form{ID: "contact", Sender: SenderFunc(func(e *Email, email *mail.Email) error {
+		if down {
+			return errors.New("connection refused")
+		}
+		sent = append(sent, email)
+		return nil
+	})}
+	form.AddEmail(Email{To: "info@example.com", From: "noreply@example.com", Subject: "New Submission"})
+
+	c := make(Config)
+	c.Add(form)
+
+	s, err := c.Parse("application/x-www-form-urlencoded", "_form_name=contact&email=person@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Attachments = []Attachment{{Filename: "cv.txt", MimeType: "text/plain", Data: []byte("resume")}}
+
+	store := NewFileStore(filepath.Join(t.TempDir(), "submissions.jsonl"))
+	sendErr := s.Send()
+	if sendErr == nil {
+		t.Fatal("Expected the first send to fail")
+	}
+	record, err := NewRecord(s, sendErr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.Replay(store)
+	if n != 0 || err == nil {
+		t.Errorf("Expected replay to fail while the server is down; Got: %d %v", n, err)
+	}
+
+	down = false
+	n, err = c.Replay(store)
+	if n != 1 || err != nil {
+		t.Fatalf("Expected replay to send the submission; Got: %d %v", n, err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 email to be sent; Got: %d", len(sent))
+	}
+	m, err := parseMessage(sent[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := m.Headers["X-Formailer-Submission-Id"]; id != s.ID {
+		t.Errorf("Expected the replayed email to keep the submission id %s; Got: %s", s.ID, id)
+	}
+	if len(m.Attachments) != 1 || string(m.Attachments[0].Data) != "resume" {
+		t.Errorf("Expected the attachment to be replayed; Got: %+v", m.Attachments)
+	}
+
+	records, err := store.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Status != StatusSent || records[0].Attempts != 3 || len(records[0].Error) > 0 {
+		t.Errorf("Unexpected record after replay: %+v", records[0])
+	}
+
+	n, err = c.Replay(store)
+	if n != 0 || err != nil || len(sent) != 1 {
+		t.Errorf("Expected sent submissions not to be replayed; Got: %d %v", n, err)
+	}
+}
+
+func TestReplaySkipsDelivered(t *testing.T) {
+	down := true
+	var sent []string
+	form := &Form{ID: "contact", Sender: SenderFunc(func(e *Email, email *mail.Email) error {
+		if down && e.ID == "support" {
+			return errors.New("connection refused")
+		}
+		sent = append(sent, or(e.ID, email.GetRecipients()[0]))
+		return nil
+	})}
+	form.AddEmail(
+		Email{ID: "sales", To: "sales@example.com", From: "noreply@example.com"},
+		Email{ID: "support", To: "support@example.com", From: "noreply@example.com"},
+		Email{To: "archive@example.com", From: "noreply@example.com"},
+	)
+	form.AutoReply = &AutoReply{Field: "email", Email: Email{From: "noreply@example.com"}}
+
+	c := make(Config)
+	c.Add(form)
+	s, err := c.Parse("application/x-www-form-urlencoded", "_form_name=contact&email=person@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewFileStore(filepath.Join(t.TempDir(), "submissions.jsonl"))
+	record, err := NewRecord(s, s.Send())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(record.Delivered, []string{"sales", "archive@example.com"}) {
+		t.Errorf("Unexpected delivered emails: %v", record.Delivered)
+	}
+	if err := store.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	sent = nil
+	down = false
+	if n, err := c.Replay(store); n != 1 || err != nil {
+		t.Fatalf("Expected replay to send the submission; Got: %d %v", n, err)
+	}
+	if !cmp.Equal(sent, []string{"support", "person@example.com"}) {
+		t.Errorf("Expected only the failed email and the auto-reply to be replayed; Got: %v", sent)
+	}
+}
+
+func TestReplayMissingForm(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "submissions.jsonl"))
+	store.Save(testRecord("orphan", StatusFailed, time.Now()))
+
+	_, err := make(Config).Replay(store)
+	if err == nil || err.Error() != "failed to replay orphan: missing form config for form contact" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
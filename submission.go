@@ -2,11 +2,15 @@ package formailer
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/url"
+	"os"
 	"sort"
 	"strings"
 )
@@ -14,6 +18,10 @@ import (
 // Submission is the unmarshaled version on the form submission.
 // It contains the submitted values and the form settings needed for sending emails.
 type Submission struct {
+	// ID uniquely identifies the submission. Every email sent for it has an X-Formailer-Submission-Id header so they can be correlated.
+	// Parse sets a random ID and Send generates one when it's empty.
+	ID string
+
 	// Form is the form this submission submitted as.
 	Form *Form
 
@@ -27,19 +35,37 @@ type Submission struct {
 
 	// Attachments is a list of files to be attached to the email
 	Attachments []Attachment
+
+	// Spam marks the submission as suspected spam. Emails are sent with Form.CaptchaSpamTag prefixed to their subject.
+	Spam bool
+
+	// attachmentErrors lists the fields with files dropped for breaking Form.AttachmentLimits
+	attachmentErrors ValidationError
+
+	// skip holds the names of emails already delivered which Send leaves out when replaying
+	skip map[string]bool
 }
 
 // Attachment contains file data for an email attachment
 type Attachment struct {
-	Filename string
-	MimeType string
-	Data     []byte
-}
+	// Field is the form field the file was uploaded in.
+	Field string `json:"field,omitempty"`
 
-var forceStringFields = []string{
-	"_form_name", "g-recaptcha-response",
+	Filename string `json:"filename"`
+
+	// MimeType is detected from the content when parsing, see AttachmentLimits.MimeTypes. It is the type the file is attached to emails with.
+	MimeType string `json:"mime_type"`
+
+	// Data is the content of the file. It is nil when the file was too large to keep in memory and was written to Path instead.
+	Data []byte `json:"data"`
+
+	// Path is a temporary file holding the content of large uploads. Submission.Cleanup removes it.
+	// It isn't stored since the file is gone once the request is over, NewRecord reads it into Data.
+	Path string `json:"-"`
 }
 
+var forceStringFields = append([]string{"_form_name"}, captchaFields...)
+
 func (s *Submission) forceString(vals url.Values) {
 	for _, key := range forceStringFields {
 		s.Values[key] = vals.Get(key)
@@ -48,7 +74,7 @@ func (s *Submission) forceString(vals url.Values) {
 
 func (s *Submission) removeIgnored() {
 	for i := 0; i < len(s.Order); i++ {
-		if s.Form.ignore[s.Order[i]] {
+		if s.Form.ignore[s.Order[i]] || contains(s.Form.Honeypot, s.Order[i]) {
 			s.Order = append(s.Order[:i], s.Order[i+1:]...)
 			i--
 		}
@@ -98,15 +124,14 @@ func (s *Submission) parseURLEncoded(body string) error {
 	return nil
 }
 
-func (s *Submission) parseMultipartForm(boundary, body string) error {
-	decodedBody, err := base64.StdEncoding.DecodeString(body)
-	if err != nil {
-		decodedBody = []byte(body)
-	}
-	decodedBody = append(decodedBody, '\n')
+// parseMultipartForm streams the parts of the body keeping up to maxMemory bytes in memory.
+// limits returns the attachment limits for the form submitted so far, files over the size limits are skipped without being stored.
+func (s *Submission) parseMultipartForm(boundary string, r io.Reader, maxMemory int64, limits func() AttachmentLimits) error {
+	// The newline ends the closing boundary for clients that leave it off
+	reader := multipart.NewReader(io.MultiReader(r, strings.NewReader("\n")), boundary)
 
 	values := make(url.Values)
-	reader := multipart.NewReader(bytes.NewReader(decodedBody), boundary)
+	budget := maxMemory
 	for {
 		part, err := reader.NextPart()
 		if err == io.EOF {
@@ -117,19 +142,32 @@ func (s *Submission) parseMultipartForm(boundary, body string) error {
 		}
 
 		key := part.FormName()
-		value := new(bytes.Buffer)
-		value.ReadFrom(part)
-
 		filename := part.FileName()
 		if len(filename) > 0 {
-			attachment := Attachment{
-				Filename: part.FileName(),
-				MimeType: part.Header.Get("Content-Type"),
-				Data:     value.Bytes(),
+			limit, message := limits().remaining(filename, s.Attachments)
+			data, path, ok, err := readFile(part, &budget, limit)
+			if err != nil {
+				return err
+			}
+			if ok {
+				// The Content-Type sent by the client isn't trusted
+				attachment := Attachment{Field: key, Filename: filename, Data: data, Path: path}
+				attachment.MimeType = attachment.contentType()
+				s.Attachments = append(s.Attachments, attachment)
+			} else if !s.attachmentErrors.has(key) {
+				s.attachmentErrors = append(s.attachmentErrors, FieldError{Field: key, Message: message})
 			}
-			s.Attachments = append(s.Attachments, attachment)
-			values[key] = append(values[key], part.FileName())
+			values[key] = append(values[key], filename)
 		} else {
+			value := new(bytes.Buffer)
+			n, err := value.ReadFrom(io.LimitReader(part, budget+1))
+			if err != nil {
+				return err
+			}
+			if n > budget {
+				return fmt.Errorf("form values are larger than %d bytes", maxMemory)
+			}
+			budget -= n
 			values[key] = append(values[key], value.String())
 		}
 
@@ -145,18 +183,148 @@ func (s *Submission) parseMultipartForm(boundary, body string) error {
 	return nil
 }
 
-// Send sends all the emails for this form
+// readFile keeps a file in memory while it fits in the remaining budget, otherwise it is written to a temporary file.
+// Files larger than limit bytes are read to the end without being kept and ok is false. A negative limit doesn't limit the size.
+func readFile(r io.Reader, budget *int64, limit int64) (data []byte, path string, ok bool, err error) {
+	src := r
+	if limit >= 0 {
+		src = io.LimitReader(r, limit+1)
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := io.CopyN(buf, src, *budget+1)
+	if err != nil && err != io.EOF {
+		return nil, "", false, err
+	}
+	if n <= *budget {
+		if limit >= 0 && n > limit {
+			_, err = io.Copy(io.Discard, r)
+			return nil, "", false, err
+		}
+		*budget -= n
+		return buf.Bytes(), "", true, nil
+	}
+
+	file, err := os.CreateTemp("", "formailer-*")
+	if err != nil {
+		return nil, "", false, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	written, err := io.Copy(file, io.MultiReader(buf, src))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, "", false, err
+	}
+	if limit >= 0 && written > limit {
+		os.Remove(file.Name())
+		_, err = io.Copy(io.Discard, r)
+		return nil, "", false, err
+	}
+	return nil, file.Name(), true, nil
+}
+
+// readBody reads a body that has to be parsed in one piece, up to maxMemory bytes
+func readBody(r io.Reader, maxMemory int64) (string, error) {
+	body, err := io.ReadAll(io.LimitReader(r, maxMemory+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(body)) > maxMemory {
+		return "", fmt.Errorf("body is larger than %d bytes", maxMemory)
+	}
+	return string(body), nil
+}
+
+// contextReader stops reading once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// HoneypotFilled reports whether any of the form's honeypot fields have a value, meaning the submission was most likely sent by a bot.
+func (s *Submission) HoneypotFilled() bool {
+	for _, field := range s.Form.Honeypot {
+		for _, v := range values(s.Values[field]) {
+			if len(strings.TrimSpace(v)) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// threadID returns a Message-Id derived from the Form.ThreadField value, or an empty string when threading is off.
+// Submissions with the same value all reply to it so mail clients thread them together.
+// The value is hashed so it isn't exposed in the headers.
+func (s *Submission) threadID(domain string) string {
+	if s.Form == nil || len(s.Form.ThreadField) < 1 {
+		return ""
+	}
+
+	vals := values(s.Values[s.Form.ThreadField])
+	if len(vals) < 1 || len(strings.TrimSpace(vals[0])) < 1 {
+		return ""
+	}
+
+	key := strings.ToLower(or(s.Form.ID, s.Form.Name)) + "\x00" + strings.ToLower(strings.TrimSpace(vals[0]))
+	sum := sha256.Sum256([]byte(key))
+	return "<thread." + hex.EncodeToString(sum[:16]) + "@" + domain + ">"
+}
+
+// Send sends the form's emails whose conditions pass followed by the auto-reply.
+// Every email is attempted even when one fails. The auto-reply is only sent once all the form's emails have been delivered.
+// When any email fails a *SendError is returned with the result of each email.
 func (s *Submission) Send() error {
-	for _, e := range s.Form.Emails {
-		email, err := e.Email(s)
+	_, err := s.Deliver()
+	return err
+}
+
+// Deliver sends the emails the same as Send returning the result of every email that was selected, including the auto-reply.
+func (s *Submission) Deliver() ([]SendResult, error) {
+	if len(s.ID) < 1 {
+		id, err := randomID(16)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to generate submission id: %w", err)
 		}
+		s.ID = id
+	}
 
-		if err := e.Send(email); err != nil {
-			return err
+	selected, err := s.Selected()
+	if err != nil {
+		return nil, err
+	}
+
+	var emails []Email
+	for i := range selected {
+		if !s.delivered(&selected[i], false) {
+			emails = append(emails, selected[i])
 		}
 	}
 
-	return nil
+	results := s.sendAll(emails)
+	failed := false
+	for _, r := range results {
+		failed = failed || r.Err != nil
+	}
+
+	if !failed {
+		if r := s.autoReply(); r != nil {
+			results = append(results, *r)
+			failed = r.Err != nil
+		}
+	}
+
+	if failed {
+		return results, &SendError{Results: results}
+	}
+	return results, nil
 }
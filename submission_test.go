@@ -2,10 +2,16 @@ package formailer
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"mime/multipart"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -84,7 +90,7 @@ func TestParseMultipartForm(t *testing.T) {
 
 	submission := new(Submission)
 	submission.Values = make(map[string]interface{})
-	err := submission.parseMultipartForm(boundary, b.String())
+	err := submission.parseMultipartForm(boundary, b, defaultMaxMemory, func() AttachmentLimits { return AttachmentLimits{} })
 	if err != nil {
 		t.Error(err)
 	}
@@ -92,3 +98,178 @@ func TestParseMultipartForm(t *testing.T) {
 		t.Errorf("Submission has incorrect order\n%v\n%v", submission.Order, expectedSubmissionOrder)
 	}
 }
+
+func TestSubmissionID(t *testing.T) {
+	c := make(Config)
+	c.Add(&Form{ID: "contact"})
+
+	first, err := c.Parse("application/x-www-form-urlencoded", "_form_name=contact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Parse("application/x-www-form-urlencoded", "_form_name=contact")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first.ID) < 1 {
+		t.Error("Expected Parse to set a submission id")
+	}
+	if first.ID == second.ID {
+		t.Errorf("Expected every submission to get its own id; Got: %s twice", first.ID)
+	}
+}
+
+func TestHoneypot(t *testing.T) {
+	c := make(Config)
+	form := &Form{ID: "honeypot", Honeypot: []string{"website"}}
+	c.Add(form)
+
+	submission, err := c.Parse("application/x-www-form-urlencoded", "_form_name=honeypot&name=Rayne&website=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submission.HoneypotFilled() {
+		t.Error("Expected empty honeypot field to pass")
+	}
+	if !cmp.Equal(submission.Order, []string{"_form_name", "name"}) {
+		t.Errorf("Honeypot field should be removed from order\n%v", submission.Order)
+	}
+
+	submission, err = c.Parse("application/json", `{"_form_name":"honeypot","name":"Rayne","website":"https://spam.example.com"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !submission.HoneypotFilled() {
+		t.Error("Expected filled honeypot field to be caught")
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	c := make(Config)
+	c.Add(&Form{ID: "upload", AttachmentLimits: AttachmentLimits{MimeTypes: []string{"image/png", "application/pdf"}}})
+
+	large := append(append([]byte{}, testPNG...), bytes.Repeat([]byte{0}, 100)...)
+	contentType, body := multipartBody(map[string]string{"_form_name": "upload"},
+		Attachment{Field: "small", Filename: "small.pdf", MimeType: "application/pdf", Data: testPDF},
+		Attachment{Field: "large", Filename: "large.png", MimeType: "image/png", Data: large},
+	)
+
+	s, err := c.ParseReader(context.Background(), contentType, strings.NewReader(body), WithMaxMemory(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate(); err != nil {
+		t.Errorf("Expected the spilled file to be sniffed from disk; Got: %v", err)
+	}
+	if len(s.Attachments) != 2 {
+		t.Fatalf("Expected 2 attachments; Got: %d", len(s.Attachments))
+	}
+
+	small, spilled := s.Attachments[0], s.Attachments[1]
+	if !bytes.Equal(small.Data, testPDF) || len(small.Path) > 0 {
+		t.Errorf("Expected the small file to stay in memory; Got: %+v", small)
+	}
+	if spilled.Data != nil || filepath.Dir(spilled.Path) != tmp {
+		t.Errorf("Expected the large file to be written to a temporary file; Got: %+v", spilled)
+	}
+	if data, err := spilled.Bytes(); err != nil || !bytes.Equal(data, large) {
+		t.Errorf("Unexpected temporary file content: %v", err)
+	}
+
+	email, err := (&Email{To: "a@example.com", From: "b@example.com"}).Email(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := parseMessage(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Attachments) != 2 || !bytes.Equal(m.Attachments[1].Data, large) {
+		t.Errorf("Expected both files to be attached; Got: %d", len(m.Attachments))
+	}
+
+	if err := s.Cleanup(); err != nil {
+		t.Error(err)
+	}
+	if files, _ := os.ReadDir(tmp); len(files) > 0 {
+		t.Errorf("Expected temporary files to be removed; Got: %v", files)
+	}
+}
+
+func TestParseReaderErrors(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	c := make(Config)
+	c.Add(&Form{ID: "upload"})
+
+	_, err := c.ParseReader(context.Background(), "application/json", strings.NewReader(`{"_form_name":"upload","message":"`+strings.Repeat("a", 64)+`"}`), WithMaxMemory(64))
+	if err == nil || !strings.Contains(err.Error(), "body is larger than 64 bytes") {
+		t.Errorf("Expected large JSON bodies to be rejected; Got: %v", err)
+	}
+
+	contentType, body := multipartBody(map[string]string{"_form_name": "upload", "message": strings.Repeat("a", 64)})
+	_, err = c.ParseReader(context.Background(), contentType, strings.NewReader(body), WithMaxMemory(64))
+	if err == nil || !strings.Contains(err.Error(), "form values are larger than 64 bytes") {
+		t.Errorf("Expected large form values to be rejected; Got: %v", err)
+	}
+
+	// The file is written to disk before the form is looked up so it has to be removed when that fails
+	contentType, body = multipartBody(map[string]string{"_form_name": "missing"}, Attachment{Field: "file", Filename: "a.bin", Data: bytes.Repeat([]byte{1}, 100)})
+	if _, err := c.ParseReader(context.Background(), contentType, strings.NewReader(body), WithMaxMemory(64)); err == nil {
+		t.Error("Expected an error for a missing form")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.ParseReader(ctx, contentType, strings.NewReader(body), WithMaxMemory(64))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected parsing to stop when the context is done; Got: %v", err)
+	}
+
+	if files, _ := os.ReadDir(tmp); len(files) > 0 {
+		t.Errorf("Expected temporary files to be removed after errors; Got: %v", files)
+	}
+}
+
+func TestParseBody(t *testing.T) {
+	c := make(Config)
+	c.Add(&Form{ID: "contact"})
+
+	multipartType, multipartData := multipartBody(map[string]string{"_form_name": "contact", "message": "hi"})
+	bodies := map[string]string{
+		"application/json":                  `{"_form_name":"contact","message":"hi"}`,
+		"application/x-www-form-urlencoded": "_form_name=contact&message=hi",
+		multipartType:                       multipartData,
+	}
+
+	for contentType, body := range bodies {
+		for _, encoded := range []bool{false, true} {
+			data := body
+			if encoded {
+				data = base64.StdEncoding.EncodeToString([]byte(body))
+			}
+
+			s, err := c.ParseBody(contentType, data, encoded)
+			if err != nil {
+				t.Errorf("%s base64 %v: %v", contentType, encoded, err)
+				continue
+			}
+			if first(s.Values["message"]) != "hi" {
+				t.Errorf("%s base64 %v: unexpected values %v", contentType, encoded, s.Values)
+			}
+		}
+	}
+
+	// Bodies aren't decoded unless they are flagged as base64, even when they happen to be valid base64
+	s, err := c.Parse("application/x-www-form-urlencoded", "_form_name=contact&message=aGk=")
+	if err != nil || first(s.Values["message"]) != "aGk=" {
+		t.Errorf("Expected the raw body to be used; Got: %v %v", s, err)
+	}
+	if _, err := c.ParseBody("application/json", "not base64!", true); err == nil {
+		t.Error("Expected an error for an invalid base64 body")
+	}
+}
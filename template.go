@@ -3,14 +3,84 @@ package formailer
 //go:generate go run generate/main.go
 
 import (
+	"bytes"
+	"fmt"
 	"html/template"
+	"net/mail"
 	"reflect"
+	"strings"
+	texttemplate "text/template"
+	"unicode"
 )
 
 var templateFuncMap = template.FuncMap{
 	"isSlice": isSlice,
+	"first":   first,
 }
 
 func isSlice(v interface{}) bool {
 	return reflect.TypeOf(v).Kind().String() == "slice"
 }
+
+// first returns the first value of a slice or the value itself. Useful since url encoded and multipart values are always slices.
+// Missing values are returned as an empty string.
+func first(v interface{}) interface{} {
+	if v == nil {
+		return ""
+	}
+	if !isSlice(v) {
+		return v
+	}
+
+	s := reflect.ValueOf(v)
+	if s.Len() < 1 {
+		return ""
+	}
+	return s.Index(0).Interface()
+}
+
+// renderHeader executes a header template against the submission.
+// Control characters are replaced with spaces so user input can't inject extra headers.
+func renderHeader(name, text string, s *Submission) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return sanitizeHeader(text), nil
+	}
+
+	t, err := texttemplate.New(name).Funcs(templateFuncMap).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+
+	var header bytes.Buffer
+	err = t.Execute(&header, s)
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", name, err)
+	}
+
+	return sanitizeHeader(header.String()), nil
+}
+
+// renderAddress executes an address template against the submission and verifies it is a single valid address.
+// An empty result is returned as is so optional fields can be skipped.
+func renderAddress(name, text string, s *Submission) (string, error) {
+	rendered, err := renderHeader(name, text, s)
+	if err != nil || len(rendered) < 1 {
+		return rendered, err
+	}
+
+	addr, err := mail.ParseAddress(rendered)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s address %q: %w", name, rendered, err)
+	}
+	return addr.String(), nil
+}
+
+func sanitizeHeader(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, v)
+	return strings.TrimSpace(v)
+}
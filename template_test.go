@@ -26,3 +26,54 @@ func TestIsSlice(t *testing.T) {
 		}
 	}
 }
+
+func TestRenderHeader(t *testing.T) {
+	submission := &Submission{
+		Form: testForm,
+		Values: map[string]interface{}{
+			"name":    []string{"Rayne\r\nBcc: victim@example.com", "Atwood"},
+			"company": "Example",
+		},
+	}
+
+	tests := map[string]string{
+		"New submission":                              "New submission",
+		"New quote from {{first .Values.name}}":       "New quote from Rayne  Bcc: victim@example.com",
+		"{{.Values.company}} {{first .Values.email}}": "Example",
+	}
+
+	for text, expected := range tests {
+		r, err := renderHeader("Subject", text, submission)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != expected {
+			t.Errorf("Unexpected result from renderHeader\nExpected: %q; Got: %q", expected, r)
+		}
+	}
+}
+
+func TestRenderAddress(t *testing.T) {
+	submission := &Submission{
+		Form: testForm,
+		Values: map[string]interface{}{
+			"email":     []string{"rayne@example.com"},
+			"injection": []string{"rayne@example.com, victim@example.com"},
+			"crlf":      "rayne@example.com\r\nBcc: victim@example.com",
+		},
+	}
+
+	tests := map[string]bool{
+		"{{first .Values.email}}":     true,
+		"{{first .Values.missing}}":   true,
+		"{{first .Values.injection}}": false,
+		"{{.Values.crlf}}":            false,
+	}
+
+	for text, valid := range tests {
+		_, err := renderAddress("Reply-To", text, submission)
+		if (err == nil) != valid {
+			t.Errorf("Unexpected result from renderAddress on %s\nExpected valid: %t; Got: %v", text, valid, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package formailer
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Rule is a set of constraints for a single submitted field.
+// Zero values are ignored so only the constraints you set are checked.
+// Apart from Required and MaxCount, rules are only checked against non-empty values.
+type Rule struct {
+	// Required fails when the field is missing or every value is blank.
+	Required bool `yaml:"required"`
+
+	// MinLength and MaxLength limit the number of characters in each value.
+	MinLength int `yaml:"min_length"`
+	MaxLength int `yaml:"max_length"`
+
+	// Pattern is a regular expression each value must match.
+	Pattern string `yaml:"pattern"`
+
+	// Email, URL and Phone check that each value is a bare email address, an absolute http(s) URL, or a phone number.
+	Email bool `yaml:"email"`
+	URL   bool `yaml:"url"`
+	Phone bool `yaml:"phone"`
+
+	// Number requires each value to be a number. Setting Min or Max implies Number.
+	Number bool     `yaml:"number"`
+	Min    *float64 `yaml:"min"`
+	Max    *float64 `yaml:"max"`
+
+	// Choices limits values to the listed options.
+	Choices []string `yaml:"choices"`
+
+	// MaxCount limits how many values a field can have. Useful for checkboxes and multi-selects.
+	MaxCount int `yaml:"max_count"`
+
+	// Message replaces the generated error message when any constraint fails.
+	Message string `yaml:"message"`
+}
+
+// FieldError describes why a single field failed validation.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError is returned by Submission.Validate and lists every field that failed.
+type ValidationError []FieldError
+
+func (v ValidationError) Error() string {
+	messages := make([]string, len(v))
+	for i, f := range v {
+		messages[i] = f.Field + " " + f.Message
+	}
+	return "invalid submission: " + strings.Join(messages, "; ")
+}
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9 ().\-]+$`)
+
+// patterns caches compiled rule and condition patterns so they aren't compiled again for every submission
+var patterns sync.Map
+
+// compilePattern compiles a regular expression the first time it is used
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(expr, re)
+	return re, nil
+}
+
+// AddRule sets the validation rule for a field replacing any existing rule.
+func (f *Form) AddRule(field string, rule Rule) {
+	if f.Rules == nil {
+		f.Rules = make(map[string]Rule)
+	}
+	f.Rules[field] = rule
+}
+
+// Validate checks the submitted values against Form.Rules and reports files dropped for breaking Form.AttachmentLimits.
+// It returns a ValidationError listing every invalid field or nil.
+func (s *Submission) Validate() error {
+	if s.Form == nil || (len(s.Form.Rules) < 1 && len(s.attachmentErrors) < 1) {
+		return nil
+	}
+
+	fields := make([]string, 0, len(s.Form.Rules))
+	for field := range s.Form.Rules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var errs ValidationError
+	for _, field := range fields {
+		rule := s.Form.Rules[field]
+		message, err := rule.check(values(s.Values[field]))
+		if err != nil {
+			return fmt.Errorf("invalid rule for %s: %w", field, err)
+		}
+		if len(message) > 0 {
+			errs = append(errs, FieldError{Field: field, Message: or(rule.Message, message)})
+		}
+	}
+
+	for _, f := range s.attachmentErrors {
+		if !errs.has(f.Field) {
+			errs = append(errs, f)
+		}
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Field < errs[j].Field
+	})
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// has reports whether the field already has an error
+func (v ValidationError) has(field string) bool {
+	for _, f := range v {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// values flattens a submitted value into a list of strings
+func values(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		vals := make([]string, len(v))
+		for i := range v {
+			vals[i] = fmt.Sprint(v[i])
+		}
+		return vals
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// check returns a message describing the first failed constraint, or an empty string when vals are valid.
+// An error is only returned when the rule itself is invalid.
+func (r Rule) check(vals []string) (string, error) {
+	present := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if len(strings.TrimSpace(v)) > 0 {
+			present = append(present, v)
+		}
+	}
+
+	if r.Required && len(present) < 1 {
+		return "is required", nil
+	}
+	if r.MaxCount > 0 && len(vals) > r.MaxCount {
+		return fmt.Sprintf("must have at most %d values", r.MaxCount), nil
+	}
+
+	var pattern *regexp.Regexp
+	if len(r.Pattern) > 0 {
+		var err error
+		pattern, err = compilePattern(r.Pattern)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for _, v := range present {
+		length := utf8.RuneCountInString(v)
+		if r.MinLength > 0 && length < r.MinLength {
+			return fmt.Sprintf("must be at least %d characters", r.MinLength), nil
+		}
+		if r.MaxLength > 0 && length > r.MaxLength {
+			return fmt.Sprintf("must be at most %d characters", r.MaxLength), nil
+		}
+		if pattern != nil && !pattern.MatchString(v) {
+			return "is not in the correct format", nil
+		}
+		if r.Email && !isEmail(v) {
+			return "must be a valid email address", nil
+		}
+		if r.URL && !isURL(v) {
+			return "must be a valid URL", nil
+		}
+		if r.Phone && !isPhone(v) {
+			return "must be a valid phone number", nil
+		}
+		if r.Number || r.Min != nil || r.Max != nil {
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return "must be a number", nil
+			}
+			if r.Min != nil && n < *r.Min {
+				return fmt.Sprintf("must be at least %g", *r.Min), nil
+			}
+			if r.Max != nil && n > *r.Max {
+				return fmt.Sprintf("must be at most %g", *r.Max), nil
+			}
+		}
+		if len(r.Choices) > 0 && !contains(r.Choices, v) {
+			return "must be one of " + strings.Join(r.Choices, ", "), nil
+		}
+	}
+
+	return "", nil
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmail only allows a bare address, display names and groups are rejected
+func isEmail(v string) bool {
+	addr, err := mail.ParseAddress(v)
+	return err == nil && addr.Address == v
+}
+
+func isURL(v string) bool {
+	u, err := url.ParseRequestURI(v)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && len(u.Host) > 0
+}
+
+func isPhone(v string) bool {
+	if !phonePattern.MatchString(v) {
+		return false
+	}
+
+	digits := 0
+	for _, c := range v {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
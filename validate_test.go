@@ -0,0 +1,92 @@
+package formailer
+
+import (
+	"errors"
+	"testing"
+)
+
+type testRule struct {
+	rule  Rule
+	value interface{}
+	valid bool
+}
+
+func TestRuleCheck(t *testing.T) {
+	min, max := 1.0, 10.0
+	tests := []testRule{
+		{Rule{Required: true}, nil, false},
+		{Rule{Required: true}, "   ", false},
+		{Rule{Required: true}, []string{"", "value"}, true},
+		{Rule{Email: true}, "", true},
+		{Rule{Email: true}, "rayne@example.com", true},
+		{Rule{Email: true}, "Rayne <rayne@example.com>", false},
+		{Rule{Email: true}, "not an email", false},
+		{Rule{URL: true}, "https://example.com/path", true},
+		{Rule{URL: true}, "javascript:alert(1)", false},
+		{Rule{Phone: true}, "+1 (555) 123-4567", true},
+		{Rule{Phone: true}, "555-HELP", false},
+		{Rule{MinLength: 3}, "ab", false},
+		{Rule{MaxLength: 3}, "日本語", true},
+		{Rule{MaxLength: 3}, "abcd", false},
+		{Rule{Pattern: `^[A-Z]{2}\d{4}$`}, "AB1234", true},
+		{Rule{Pattern: `^[A-Z]{2}\d{4}$`}, "ab1234", false},
+		{Rule{Number: true}, "12.5", true},
+		{Rule{Number: true}, "twelve", false},
+		{Rule{Min: &min, Max: &max}, 5.0, true},
+		{Rule{Min: &min, Max: &max}, "11", false},
+		{Rule{Min: &min}, "0", false},
+		{Rule{Choices: []string{"sales", "support"}}, "sales", true},
+		{Rule{Choices: []string{"sales", "support"}}, []interface{}{"sales", "billing"}, false},
+		{Rule{MaxCount: 2}, []string{"a", "b"}, true},
+		{Rule{MaxCount: 2}, []string{"a", "b", "c"}, false},
+	}
+
+	for i, test := range tests {
+		message, err := test.rule.check(values(test.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if valid := len(message) < 1; valid != test.valid {
+			t.Errorf("Unexpected result from Rule.check on test %d (%v)\nExpected: %t; Got: %t %s", i, test.value, test.valid, valid, message)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	form := &Form{ID: "validate"}
+	form.AddRule("email", Rule{Required: true, Email: true})
+	form.AddRule("name", Rule{Required: true, Message: "tell us your name"})
+	form.AddRule("message", Rule{MaxLength: 10})
+
+	submission := &Submission{
+		Form: form,
+		Values: map[string]interface{}{
+			"email":   []string{"not an email"},
+			"message": []string{"short"},
+		},
+	}
+
+	var invalid ValidationError
+	if err := submission.Validate(); !errors.As(err, &invalid) {
+		t.Fatalf("Expected ValidationError; Got: %v", err)
+	}
+
+	expected := ValidationError{
+		{Field: "email", Message: "must be a valid email address"},
+		{Field: "name", Message: "tell us your name"},
+	}
+	if len(invalid) != len(expected) {
+		t.Fatalf("Unexpected field errors\nExpected: %v; Got: %v", expected, invalid)
+	}
+	for i := range expected {
+		if invalid[i] != expected[i] {
+			t.Errorf("Unexpected field error\nExpected: %v; Got: %v", expected[i], invalid[i])
+		}
+	}
+
+	submission.Values["email"] = "rayne@example.com"
+	submission.Values["name"] = []string{"Rayne"}
+	if err := submission.Validate(); err != nil {
+		t.Error(err)
+	}
+}